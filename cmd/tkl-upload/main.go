@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mrsydar/tkl/credentials"
+	"mrsydar/tkl/k360/client"
+	"mrsydar/tkl/nbp"
+	"mrsydar/tkl/process"
+	"mrsydar/tkl/profile"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+const (
+	exitOk      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitSkipped = 3
+)
+
+// tkl-upload runs the upload without the window, e.g. from cron on a
+// headless machine. It's a separate binary as the window needs X11 and
+// OpenGL libraries just to start.
+func main() {
+	os.Exit(runUpload(os.Args[1:]))
+}
+
+func runUpload(args []string) int {
+	flags := flag.NewFlagSet("tkl-upload", flag.ContinueOnError)
+	csvPath := flags.String("csv", "", "path to the TKL report")
+	profileName := flags.String("profile", "", "name of the profile with the Księgowość360 account and defaults to use")
+	apiId := flags.String("api-id", "", "Księgowość360 API ID, overrides the profile")
+	apiKeyFile := flags.String("api-key-file", "", "path to a file containing the Księgowość360 API key, the key saved by the window is used if not set")
+	defaultTaxId := flags.String("default-tax-id", "", "tax id used for records with empty tax_id, overrides the profile")
+	defaultCustomerId := flags.String("default-customer-id", "", "customer id used for records without customer_id and customer_nip, overrides the profile")
+	defaultPaymentDays := flags.Int("default-payment-days", -1, "payment term in days of records without due_date and payment_days, overrides the profile")
+	columnsPath := flags.String("columns", "", "path to a JSON file mapping report columns to header names")
+	force := flags.Bool("force", false, "upload valid invoices even if the report has validation problems")
+	dryRun := flags.Bool("dry-run", false, "don't send anything, write planned actions to "+process.DryRunReportPath+" instead")
+	dryRunLookups := flags.Bool("dry-run-lookups", true, "look up existing customers in Księgowość360 during a dry run")
+	taxTolerance := flags.Float64("tax-tolerance", process.DefaultTaxTolerance, "largest accepted difference between taxes in the report and taxes calculated from net values")
+	mode := flags.String("mode", "sales", "invoices in the report: sales or purchase (received from vendors, customer_nip and customer_id are the vendor's)")
+	group := flags.String("group", "consecutive", "which records with the same invoice number make up one invoice: consecutive or all")
+	amounts := flags.String("amounts", "net", "amounts taken from the report: net (net and tax columns) or gross (gross column, tax calculated from the VAT rate)")
+	dateFormats := flags.String("date-formats", "", "comma separated formats of the date column like dd.MM.yyyy, "+strings.Join(process.DefaultDateFormats, ", ")+" if not set")
+	from := flags.String("from", "", "first allowed invoice date in yyyy-MM-dd format")
+	to := flags.String("to", "", "last allowed invoice date in yyyy-MM-dd format")
+	month := flags.String("month", "", "accounting month of the report in yyyy-MM format, invoices dated outside of it are reported")
+	monthCheck := flags.String("month-check", "warn", "what to do with invoices outside of --month: warn or block")
+	ratesFile := flags.String("rates-file", "", "path to a CSV file with NBP exchange rates (currency,date,mid) used instead of the NBP web API")
+	workers := flags.Int("workers", process.DefaultWorkers, "number of invoices uploaded concurrently")
+	logPath := flags.String("log", "output.log", "path to the log file")
+	baseURL := flags.String("base-url", client.DefaultBaseURL, "Księgowość360 API base url")
+	attempts := flags.Int("attempts", client.DefaultRetryPolicy.MaxAttempts, "maximum number of attempts of a Księgowość360 API request failed with a transient error")
+	rateLimit := flags.Float64("rate-limit", client.DefaultRateLimit, "maximum number of Księgowość360 API requests per second, 0 disables the limit")
+	timeout := flags.Duration("timeout", client.DefaultTimeout, "timeout of a single Księgowość360 API request")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *profileName != "" {
+		selected, err := loadProfile(*profileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+			return exitFailure
+		}
+
+		if *apiId == "" {
+			*apiId = selected.ApiId
+		}
+		if *defaultTaxId == "" {
+			*defaultTaxId = selected.DefaultTaxId
+		}
+		if *defaultCustomerId == "" {
+			*defaultCustomerId = selected.DefaultCustomerId
+		}
+		if *defaultPaymentDays < 0 {
+			*defaultPaymentDays = selected.DefaultPaymentDays
+		}
+	}
+
+	if *csvPath == "" || *apiId == "" {
+		fmt.Fprintln(os.Stderr, "tkl-upload: --csv and --api-id or --profile are required")
+		flags.Usage()
+		return exitUsage
+	}
+
+	apiKey, err := readApiKey(*apiKeyFile, *apiId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: can't read api key: %v\n", err)
+		return exitFailure
+	}
+
+	if *defaultPaymentDays < 0 {
+		*defaultPaymentDays = 0
+	}
+
+	if *taxTolerance < 0 {
+		fmt.Fprintln(os.Stderr, "tkl-upload: --tax-tolerance can't be negative")
+		return exitUsage
+	}
+
+	invoiceMode, err := process.ParseMode(*mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	grouping, err := process.ParseGrouping(*group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	amountsMode, err := process.ParseAmounts(*amounts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	dateFormatList, err := process.ParseDateFormats(*dateFormats)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	period, err := process.ParsePeriod(*from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	accountingMonth, err := process.ParseMonth(*month)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	monthCheckMode, err := process.ParseMonthCheck(*monthCheck)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitUsage
+	}
+
+	options := process.Options{
+		Mode:              invoiceMode,
+		Grouping:          grouping,
+		Amounts:           amountsMode,
+		DateFormats:       dateFormatList,
+		Period:            period,
+		Month:             accountingMonth,
+		MonthCheck:        monthCheckMode,
+		TaxTolerance:      *taxTolerance,
+		DryRun:            *dryRun,
+		DryRunLookups:     *dryRunLookups,
+		Workers:           *workers,
+		DefaultTaxId:      *defaultTaxId,
+		DefaultCustomerId: *defaultCustomerId,
+
+		DefaultPaymentDays: *defaultPaymentDays,
+	}
+	if *columnsPath != "" {
+		options.Columns, err = process.LoadColumnMapping(*columnsPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	if *ratesFile != "" {
+		options.CurrencyRates, err = nbp.LoadFile(*ratesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	logFile, err := os.Create(*logPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: can't create/truncate log file: %v\n", err)
+		return exitFailure
+	}
+	defer logFile.Close()
+
+	log.SetOutput(logFile)
+
+	retryPolicy := client.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = *attempts
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	k360Client := client.New(
+		*apiId,
+		apiKey,
+		client.WithBaseURL(*baseURL),
+		client.WithHTTPClient(&http.Client{Timeout: *timeout}),
+		client.WithRetry(retryPolicy),
+		client.WithRateLimit(*rateLimit),
+	)
+
+	if !options.DryRun || options.DryRunLookups {
+		if err := k360Client.VerifyCredentials(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	problems, err := process.ValidateReport(*csvPath, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitFailure
+	}
+
+	if len(problems) != 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+
+		if !*force {
+			fmt.Fprintf(os.Stderr, "tkl-upload: report has %d problems, fix them or use --force to upload only valid invoices\n", len(problems))
+			return exitFailure
+		}
+		options.IgnoreValidationErrors = true
+	}
+
+	outOfMonth, err := process.CheckMonth(*csvPath, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		return exitFailure
+	}
+	if len(outOfMonth.Invoices) != 0 {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v: %v\n", outOfMonth, strings.Join(outOfMonth.Invoices, ", "))
+		if options.MonthCheck == process.MonthBlock {
+			return exitFailure
+		}
+	}
+
+	summary, err := process.ProcessInvoices(
+		ctx,
+		*k360Client,
+		*csvPath,
+		options,
+		func(message string, recordsNumber, currentRecord int) {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", currentRecord, recordsNumber, message)
+		},
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tkl-upload: %v\n", err)
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "not attempted invoices were written to %v\n", skippedPath(options))
+		}
+		return exitFailure
+	}
+
+	fmt.Fprintf(os.Stderr, "processed %d invoices, skipped %d, duplicates %d, completed in a previous run %d\n", summary.Records, summary.Skipped, summary.Duplicates, summary.Resumed)
+	if options.DryRun {
+		fmt.Fprintf(os.Stderr, "planned actions were written to %v\n", process.DryRunReportPath)
+	}
+	if summary.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped invoices were written to %v\n", skippedPath(options))
+		return exitSkipped
+	}
+
+	return exitOk
+}
+
+func readApiKey(path, apiId string) (string, error) {
+	if path == "" {
+		dir, err := credentials.DefaultDir()
+		if err != nil {
+			return "", err
+		}
+		return credentials.New(dir).Get(apiId)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	apiKey := strings.TrimSpace(string(data))
+	if apiKey == "" {
+		return "", fmt.Errorf("file %v is empty", path)
+	}
+
+	return apiKey, nil
+}
+
+func loadProfile(name string) (profile.Profile, error) {
+	path, err := profile.DefaultPath()
+	if err != nil {
+		return profile.Profile{}, err
+	}
+
+	profiles, err := profile.Load(path)
+	if err != nil {
+		return profile.Profile{}, err
+	}
+
+	return profiles.Get(name)
+}
+
+func skippedPath(options process.Options) string {
+	if options.DryRun {
+		return process.DryRunSkippedInvoicesPath
+	}
+	return process.SkippedInvoicesPath
+}
@@ -0,0 +1,76 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotFound = errors.New("no stored API key")
+
+// Store keeps API keys of Księgowość360 accounts, identified by their API ID.
+type Store interface {
+	Get(apiId string) (string, error)
+	Set(apiId, apiKey string) error
+	Delete(apiId string) error
+}
+
+// DefaultDir returns the directory where tkl keeps its configuration.
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tkl"), nil
+}
+
+// New returns a store which uses the OS keyring when it's available and
+// falls back to an encrypted file in dir.
+func New(dir string) Store {
+	stores := systemStores()
+	stores = append(stores, NewFileStore(dir))
+	return &fallbackStore{stores}
+}
+
+type fallbackStore struct {
+	stores []Store
+}
+
+func (store *fallbackStore) Get(apiId string) (string, error) {
+	for _, s := range store.stores {
+		apiKey, err := s.Get(apiId)
+		if err == nil {
+			return apiKey, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("failed to get API key from %T: %v\n", s, err)
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (store *fallbackStore) Set(apiId, apiKey string) error {
+	var errs []error
+	for _, s := range store.stores {
+		err := s.Set(apiId, apiKey)
+		if err == nil {
+			return nil
+		}
+		log.Printf("failed to save API key to %T: %v\n", s, err)
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("failed to save API key: %v", errs)
+}
+
+func (store *fallbackStore) Delete(apiId string) error {
+	var lastErr error
+	for _, s := range store.stores {
+		if err := s.Delete(apiId); err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("failed to delete API key from %T: %v\n", s, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
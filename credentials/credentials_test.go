@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+
+	if _, err := store.Get("id-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v", ErrNotFound, err)
+	}
+
+	if err := store.Set("id-1", "secret-key-1"); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if err := store.Set("id-2", "secret-key-2"); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	apiKey, err := NewFileStore(dir).Get("id-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if apiKey != "secret-key-1" {
+		t.Fatalf("expected %q, but got %q", "secret-key-1", apiKey)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, fileStoreName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Fatalf("credentials file is not encrypted: %q", data)
+	}
+
+	if err := store.Delete("id-1"); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if _, err := store.Get("id-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v", ErrNotFound, err)
+	}
+	if apiKey, _ := store.Get("id-2"); apiKey != "secret-key-2" {
+		t.Fatalf("expected other keys to be kept, but got %q", apiKey)
+	}
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Get(apiId string) (string, error) { return "", errors.New("no keyring") }
+func (brokenStore) Set(apiId, apiKey string) error   { return errors.New("no keyring") }
+func (brokenStore) Delete(apiId string) error        { return errors.New("no keyring") }
+
+func TestFallbackStore(t *testing.T) {
+	file := NewFileStore(t.TempDir())
+	store := &fallbackStore{[]Store{brokenStore{}, file}}
+
+	if err := store.Set("id-1", "secret-key-1"); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if apiKey, err := file.Get("id-1"); err != nil || apiKey != "secret-key-1" {
+		t.Fatalf("expected key to be saved in the fallback store, but got %q, %v", apiKey, err)
+	}
+
+	if apiKey, err := store.Get("id-1"); err != nil || apiKey != "secret-key-1" {
+		t.Fatalf("expected %q, but got %q, %v", "secret-key-1", apiKey, err)
+	}
+}
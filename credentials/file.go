@@ -0,0 +1,149 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	fileStoreName    = "credentials.enc"
+	fileStoreKeyName = "credentials.key"
+)
+
+// FileStore keeps API keys in a file encrypted with AES-GCM. The encryption
+// key is kept in another file of the same directory, so this is only
+// obfuscation: the API keys are protected by the permissions of the
+// directory and anyone with a copy of both files (e.g. in a backup) can read
+// them. It's the fallback for systems without a keyring.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (store *FileStore) Get(apiId string) (string, error) {
+	keys, err := store.load()
+	if err != nil {
+		return "", err
+	}
+
+	apiKey, ok := keys[apiId]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return apiKey, nil
+}
+
+func (store *FileStore) Set(apiId, apiKey string) error {
+	keys, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	keys[apiId] = apiKey
+	return store.save(keys)
+}
+
+func (store *FileStore) Delete(apiId string) error {
+	keys, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := keys[apiId]; !ok {
+		return ErrNotFound
+	}
+
+	delete(keys, apiId)
+	return store.save(keys)
+}
+
+func (store *FileStore) load() (map[string]string, error) {
+	keys := make(map[string]string)
+
+	data, err := ioutil.ReadFile(filepath.Join(store.dir, fileStoreName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return keys, nil
+		}
+		return nil, err
+	}
+
+	aead, err := store.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("credentials file is corrupted")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials file: %v", err)
+	}
+
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %v", err)
+	}
+
+	return keys, nil
+}
+
+func (store *FileStore) save(keys map[string]string) error {
+	plaintext, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	aead, err := store.cipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(store.dir, fileStoreName), aead.Seal(nonce, nonce, plaintext, nil), 0600)
+}
+
+// cipher returns the AES-GCM cipher with the key from the key file, the key
+// is generated on first use.
+func (store *FileStore) cipher() (cipher.AEAD, error) {
+	if err := os.MkdirAll(store.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(store.dir, fileStoreKeyName)
+
+	key, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(path, key, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad credentials key: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
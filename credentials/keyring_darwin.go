@@ -0,0 +1,87 @@
+//go:build darwin
+// +build darwin
+
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	keychainCommand = "/usr/bin/security"
+	keychainService = "tkl"
+
+	// keychainNotFound is the exit code of security when there's no such
+	// item.
+	keychainNotFound = 44
+)
+
+func systemStores() []Store {
+	return []Store{&KeychainStore{}}
+}
+
+// KeychainStore keeps API keys in the login keychain of macOS, using the
+// security command line tool.
+type KeychainStore struct{}
+
+func runKeychain(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(keychainCommand, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == keychainNotFound {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("%v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// quoteKeychain quotes a value for the interactive mode of security.
+func quoteKeychain(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+func (store *KeychainStore) Get(apiId string) (string, error) {
+	apiKey, err := runKeychain("", "find-generic-password", "-s", keychainService, "-a", apiId, "-w")
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to get keychain item: %v", err)
+	}
+	return strings.TrimSuffix(apiKey, "\n"), nil
+}
+
+func (store *KeychainStore) Set(apiId, apiKey string) error {
+	// the key is passed on stdin in the interactive mode, so it doesn't
+	// show up in the process list
+	command := fmt.Sprintf("add-generic-password -U -s %v -a %v -l %v -w %v\n",
+		quoteKeychain(keychainService),
+		quoteKeychain(apiId),
+		quoteKeychain("tkl: Księgowość360 API key "+apiId),
+		quoteKeychain(apiKey),
+	)
+	if _, err := runKeychain(command, "-i"); err != nil {
+		return fmt.Errorf("failed to save keychain item: %v", err)
+	}
+	return nil
+}
+
+func (store *KeychainStore) Delete(apiId string) error {
+	_, err := runKeychain("", "delete-generic-password", "-s", keychainService, "-a", apiId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete keychain item: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+//go:build linux
+// +build linux
+
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName    = "org.freedesktop.secrets"
+	secretServicePath    = "/org/freedesktop/secrets"
+	secretServiceIface   = "org.freedesktop.Secret.Service"
+	secretItemIface      = "org.freedesktop.Secret.Item"
+	secretPromptIface    = "org.freedesktop.Secret.Prompt"
+	defaultCollection    = "/org/freedesktop/secrets/aliases/default"
+	secretApplicationKey = "application"
+	secretApiIdKey       = "api_id"
+
+	// promptTimeout limits how long a keyring prompt nobody answers blocks
+	// the caller.
+	promptTimeout = 2 * time.Minute
+)
+
+func systemStores() []Store {
+	return []Store{&SecretServiceStore{}}
+}
+
+// SecretServiceStore keeps API keys in the default collection of the
+// freedesktop.org Secret Service (GNOME Keyring, KWallet).
+type SecretServiceStore struct{}
+
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type secretSession struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+	path    dbus.ObjectPath
+}
+
+func openSecretSession() (*secretSession, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %v", err)
+	}
+
+	service := conn.Object(secretServiceName, secretServicePath)
+
+	var output dbus.Variant
+	var path dbus.ObjectPath
+	err = service.Call(secretServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secret service session: %v", err)
+	}
+
+	return &secretSession{conn, service, path}, nil
+}
+
+func (session *secretSession) close() {
+	session.conn.Object(secretServiceName, session.path).Call("org.freedesktop.Secret.Session.Close", 0)
+}
+
+func attributes(apiId string) map[string]string {
+	return map[string]string{secretApplicationKey: "tkl", secretApiIdKey: apiId}
+}
+
+// prompt shows the prompt, e.g. for unlocking the keyring, and waits until
+// the user completes it or promptTimeout passes.
+func (session *secretSession) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	if path == "/" {
+		return dbus.Variant{}, nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(secretPromptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := session.conn.AddMatchSignal(match...); err != nil {
+		return dbus.Variant{}, err
+	}
+	defer session.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 1)
+	session.conn.Signal(signals)
+	defer session.conn.RemoveSignal(signals)
+
+	if err := session.conn.Object(secretServiceName, path).Call(secretPromptIface+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, err
+	}
+
+	timeout := time.NewTimer(promptTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok {
+				return dbus.Variant{}, errors.New("secret service connection closed")
+			}
+			if signal.Path != path || signal.Name != secretPromptIface+".Completed" || len(signal.Body) != 2 {
+				continue
+			}
+
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return dbus.Variant{}, errors.New("secret service prompt was dismissed")
+			}
+
+			result, _ := signal.Body[1].(dbus.Variant)
+			return result, nil
+		case <-timeout.C:
+			session.conn.Object(secretServiceName, path).Call(secretPromptIface+".Dismiss", 0)
+			return dbus.Variant{}, fmt.Errorf("secret service prompt wasn't answered in %v", promptTimeout)
+		}
+	}
+}
+
+func (session *secretSession) unlock(paths []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := session.service.Call(secretServiceIface+".Unlock", 0, paths).Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to unlock secret service: %v", err)
+	}
+
+	_, err = session.prompt(prompt)
+	return err
+}
+
+func (session *secretSession) find(apiId string) (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := session.service.Call(secretServiceIface+".SearchItems", 0, attributes(apiId)).Store(&unlocked, &locked)
+	if err != nil {
+		return "", fmt.Errorf("failed to search secret service: %v", err)
+	}
+
+	if len(unlocked) != 0 {
+		return unlocked[0], nil
+	}
+
+	if len(locked) != 0 {
+		if err := session.unlock(locked[:1]); err != nil {
+			return "", err
+		}
+		return locked[0], nil
+	}
+
+	return "", ErrNotFound
+}
+
+func (store *SecretServiceStore) Get(apiId string) (string, error) {
+	session, err := openSecretSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.close()
+
+	item, err := session.find(apiId)
+	if err != nil {
+		return "", err
+	}
+
+	var value secret
+	err = session.conn.Object(secretServiceName, item).Call(secretItemIface+".GetSecret", 0, session.path).Store(&value)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %v", err)
+	}
+
+	return string(value.Value), nil
+}
+
+func (store *SecretServiceStore) Set(apiId, apiKey string) error {
+	session, err := openSecretSession()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	if err := session.unlock([]dbus.ObjectPath{defaultCollection}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		secretItemIface + ".Label":      dbus.MakeVariant("tkl: Księgowość360 API key " + apiId),
+		secretItemIface + ".Attributes": dbus.MakeVariant(attributes(apiId)),
+	}
+	value := secret{Session: session.path, Value: []byte(apiKey), ContentType: "text/plain"}
+
+	var item, prompt dbus.ObjectPath
+	err = session.conn.Object(secretServiceName, defaultCollection).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, value, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to create secret: %v", err)
+	}
+
+	_, err = session.prompt(prompt)
+	return err
+}
+
+func (store *SecretServiceStore) Delete(apiId string) error {
+	session, err := openSecretSession()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	item, err := session.find(apiId)
+	if err != nil {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	err = session.conn.Object(secretServiceName, item).Call(secretItemIface+".Delete", 0).Store(&prompt)
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+
+	_, err = session.prompt(prompt)
+	return err
+}
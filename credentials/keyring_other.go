@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package credentials
+
+func systemStores() []Store {
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build windows
+// +build windows
+
+package credentials
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+func systemStores() []Store {
+	return []Store{&CredentialManagerStore{}}
+}
+
+// CredentialManagerStore keeps API keys as generic credentials of the
+// Windows Credential Manager.
+type CredentialManagerStore struct{}
+
+// credential is the CREDENTIALW structure of the Windows API.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+func credentialTarget(apiId string) (*uint16, error) {
+	return syscall.UTF16PtrFromString("tkl:" + apiId)
+}
+
+func (store *CredentialManagerStore) Get(apiId string) (string, error) {
+	target, err := credentialTarget(apiId)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	result, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if result == 0 {
+		if err == errorNotFound {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read credential: %v", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (store *CredentialManagerStore) Set(apiId, apiKey string) error {
+	target, err := credentialTarget(apiId)
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(apiId)
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:       credTypeGeneric,
+		TargetName: target,
+		Persist:    credPersistLocalMachine,
+		UserName:   userName,
+	}
+	if blob := []byte(apiKey); len(blob) != 0 {
+		cred.CredentialBlobSize = uint32(len(blob))
+		cred.CredentialBlob = &blob[0]
+	}
+
+	result, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if result == 0 {
+		return fmt.Errorf("failed to write credential: %v", err)
+	}
+	return nil
+}
+
+func (store *CredentialManagerStore) Delete(apiId string) error {
+	target, err := credentialTarget(apiId)
+	if err != nil {
+		return err
+	}
+
+	result, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if result == 0 {
+		if err == errorNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete credential: %v", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -9,36 +10,86 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"mrsydar/tkl/k360/customer"
 	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/k360/tax"
+	"mrsydar/tkl/k360/vendor"
+)
+
+const (
+	DefaultBaseURL   = "https://program.360ksiegowosc.pl"
+	DefaultUserAgent = "tkl"
+	DefaultTimeout   = time.Minute
 )
 
 type K360Client struct {
 	apiId  string
 	apiKey string
+
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+
+	retry   RetryPolicy
+	limiter *rateLimiter
+}
+
+type Option func(client *K360Client)
+
+func WithBaseURL(baseURL string) Option {
+	return func(client *K360Client) {
+		client.baseURL = baseURL
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *K360Client) {
+		client.httpClient = httpClient
+	}
 }
 
-func New(apiId, apiKey string) *K360Client {
-	return &K360Client{apiId, apiKey}
+func WithUserAgent(userAgent string) Option {
+	return func(client *K360Client) {
+		client.userAgent = userAgent
+	}
 }
 
-func (client *K360Client) GetCustomerId(data customer.Customer) (string, error) {
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "program.360ksiegowosc.pl",
-		Path:     "api/v1/getcustomers",
-		RawQuery: fmt.Sprintf("ApiId=%s", client.apiId),
+func New(apiId, apiKey string, options ...Option) *K360Client {
+	client := &K360Client{
+		apiId:      apiId,
+		apiKey:     apiKey,
+		baseURL:    DefaultBaseURL,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		userAgent:  DefaultUserAgent,
+		retry:      DefaultRetryPolicy,
+		limiter:    newRateLimiter(DefaultRateLimit),
 	}
 
-	response, err := client.post(url, data)
+	for _, option := range options {
+		option(client)
+	}
+
+	return client
+}
+
+func (client *K360Client) GetCustomerId(ctx context.Context, data customer.Customer) (string, error) {
+	url, err := client.endpoint("api/v1/getcustomers")
 	if err != nil {
 		return "", err
 	}
 
+	response, err := client.post(ctx, url, data)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
 	foundCustomers := []struct {
 		Id string `json:"CustomerId"`
 	}{}
@@ -59,18 +110,33 @@ func (client *K360Client) GetCustomerId(data customer.Customer) (string, error)
 	return foundCustomers[0].Id, nil
 }
 
-func (client *K360Client) PostCustomer(data customer.Customer) (string, error) {
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "program.360ksiegowosc.pl",
-		Path:     "api/v2/sendcustomer",
-		RawQuery: fmt.Sprintf("ApiId=%s", client.apiId),
+func (client *K360Client) PostCustomer(ctx context.Context, data customer.Customer) (string, error) {
+	url, err := client.endpoint("api/v2/sendcustomer")
+	if err != nil {
+		return "", err
 	}
 
-	response, err := client.post(url, data)
+	var existingId string
+	var exists func() (bool, error)
+	if data.Nip != "" {
+		exists = func() (bool, error) {
+			id, err := client.GetCustomerId(ctx, customer.Customer{Nip: data.Nip})
+			if errors.Is(err, customer.ErrNotFound) {
+				return false, nil
+			}
+			existingId = id
+			return err == nil, err
+		}
+	}
+
+	response, err := client.create(ctx, url, data, exists)
 	if err != nil {
 		return "", err
 	}
+	if response == nil {
+		return existingId, nil
+	}
+	defer response.Body.Close()
 
 	addedCustomer := struct {
 		Id string `json:"Id"`
@@ -84,28 +150,332 @@ func (client *K360Client) PostCustomer(data customer.Customer) (string, error) {
 	return addedCustomer.Id, nil
 }
 
-func (client *K360Client) PostInvoice(invoiceData invoice.Invoice) error {
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "program.360ksiegowosc.pl",
-		Path:     "api/v1/sendinvoice",
-		RawQuery: fmt.Sprintf("ApiId=%s", client.apiId),
+func (client *K360Client) PostInvoice(ctx context.Context, invoiceData invoice.Invoice) error {
+	url, err := client.endpoint("api/v1/sendinvoice")
+	if err != nil {
+		return err
+	}
+
+	response, err := client.create(ctx, url, invoiceData, func() (bool, error) {
+		return client.invoiceExists(ctx, invoiceData.No, invoiceData.DocDate)
+	})
+	if err != nil {
+		return err
+	}
+	if response != nil {
+		response.Body.Close()
+	}
+
+	return nil
+}
+
+// invoiceExists reports whether a sales invoice with the number was posted
+// on the day of docDate.
+func (client *K360Client) invoiceExists(ctx context.Context, no, docDate string) (bool, error) {
+	date, err := time.Parse("20060102150405", docDate)
+	if err != nil {
+		return false, fmt.Errorf("bad invoice date %q: %v", docDate, err)
+	}
+
+	invoices, err := client.GetInvoices(ctx, date, date)
+	if err != nil {
+		return false, err
+	}
+
+	for _, found := range invoices {
+		if found.No == no {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (client *K360Client) GetVendorId(ctx context.Context, data vendor.Vendor) (string, error) {
+	url, err := client.endpoint("api/v1/getvendors")
+	if err != nil {
+		return "", err
+	}
+
+	response, err := client.post(ctx, url, data)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	foundVendors := []struct {
+		Id string `json:"VendorId"`
+	}{}
+
+	err = unmarshalBody(*response, &foundVendors)
+	if err != nil {
+		return "", err
+	}
+
+	if len(foundVendors) != 1 {
+		if len(foundVendors) == 0 {
+			return "", vendor.ErrNotFound
+		} else {
+			return "", errors.New("too many vendors found")
+		}
+	}
+
+	return foundVendors[0].Id, nil
+}
+
+func (client *K360Client) PostVendor(ctx context.Context, data vendor.Vendor) (string, error) {
+	url, err := client.endpoint("api/v2/sendvendor")
+	if err != nil {
+		return "", err
+	}
+
+	var existingId string
+	var exists func() (bool, error)
+	if data.Nip != "" {
+		exists = func() (bool, error) {
+			id, err := client.GetVendorId(ctx, vendor.Vendor{Nip: data.Nip})
+			if errors.Is(err, vendor.ErrNotFound) {
+				return false, nil
+			}
+			existingId = id
+			return err == nil, err
+		}
+	}
+
+	response, err := client.create(ctx, url, data, exists)
+	if err != nil {
+		return "", err
+	}
+	if response == nil {
+		return existingId, nil
+	}
+	defer response.Body.Close()
+
+	addedVendor := struct {
+		Id string `json:"Id"`
+	}{}
+
+	err = unmarshalBody(*response, &addedVendor)
+	if err != nil {
+		return "", err
+	}
+
+	return addedVendor.Id, nil
+}
+
+func (client *K360Client) PostPurchaseInvoice(ctx context.Context, invoiceData invoice.PurchaseInvoice) error {
+	url, err := client.endpoint("api/v1/sendpurchinvoice")
+	if err != nil {
+		return err
+	}
+
+	// purchase invoices can't be listed, so uncertain failures aren't
+	// repeated
+	response, err := client.create(ctx, url, invoiceData, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+// PostCreditNote posts a correction of a sales invoice.
+func (client *K360Client) PostCreditNote(ctx context.Context, creditNote invoice.CreditNote) error {
+	url, err := client.endpoint("api/v1/sendcreditinvoice")
+	if err != nil {
+		return err
 	}
 
-	_, err := client.post(url, invoiceData)
+	// credit notes can't be listed, so uncertain failures aren't repeated
+	response, err := client.create(ctx, url, creditNote, nil)
 	if err != nil {
 		return err
 	}
+	response.Body.Close()
 
 	return nil
 }
 
-func (client *K360Client) post(url url.URL, data interface{}) (*http.Response, error) {
+const maxInvoicesPeriod = 3
+
+// GetInvoices lists invoices with document date between from and to. The
+// API only accepts periods up to three months long, so longer periods are
+// requested in parts.
+func (client *K360Client) GetInvoices(ctx context.Context, from, to time.Time) ([]invoice.Summary, error) {
+	url, err := client.endpoint("api/v1/getinvoices")
+	if err != nil {
+		return nil, err
+	}
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	invoices := make([]invoice.Summary, 0)
+	for periodStart := from; !periodStart.After(to); {
+		periodEnd := periodStart.AddDate(0, maxInvoicesPeriod, -1)
+		if periodEnd.After(to) {
+			periodEnd = to
+		}
+
+		query := struct {
+			PeriodStart string `json:"PeriodStart"`
+			PeriodEnd   string `json:"PeriodEnd"`
+		}{periodStart.Format("20060102"), periodEnd.Format("20060102")}
+
+		response, err := client.post(ctx, url, query)
+		if err != nil {
+			return nil, err
+		}
+
+		found := []invoice.Summary{}
+		err = unmarshalBody(*response, &found)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		invoices = append(invoices, found...)
+		periodStart = periodEnd.AddDate(0, 0, 1)
+	}
+
+	return invoices, nil
+}
+
+var ErrInvalidCredentials = errors.New("invalid API ID or API key")
+
+// VerifyCredentials checks the API ID and key with a cheap read-only
+// request, so a run with mistyped credentials can be stopped before it
+// starts.
+func (client *K360Client) VerifyCredentials(ctx context.Context) error {
+	_, err := client.GetTaxes(ctx)
+	if IsAuthError(err) {
+		return fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return err
+}
+
+func (client *K360Client) GetTaxes(ctx context.Context) ([]tax.Tax, error) {
+	url, err := client.endpoint("api/v1/gettaxes")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.post(ctx, url, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	taxes := []tax.Tax{}
+	err = unmarshalBody(*response, &taxes)
+	if err != nil {
+		return nil, err
+	}
+
+	return taxes, nil
+}
+
+func (client *K360Client) ApiId() string {
+	return client.apiId
+}
+
+func (client *K360Client) endpoint(path string) (url.URL, error) {
+	base, err := url.Parse(client.baseURL)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("bad base url %q: %v", client.baseURL, err)
+	}
+
+	endpoint := *base
+	endpoint.Path = strings.TrimSuffix(base.Path, "/") + "/" + path
+	endpoint.RawQuery = fmt.Sprintf("ApiId=%s", client.apiId)
+
+	return endpoint, nil
+}
+
+// post sends a request which only reads data to the endpoint, repeating it
+// on transient failures.
+func (client *K360Client) post(ctx context.Context, url url.URL, data interface{}) (*http.Response, error) {
+	return client.postWithRetry(ctx, url, data, nil)
+}
+
+// create sends a request creating an invoice, customer or vendor. Such
+// requests aren't idempotent, so after a transient failure they are only
+// repeated when they certainly weren't processed or when exists reports
+// nothing was created. Without exists other failures are returned as
+// UncertainError. A nil response without error means exists found what an
+// earlier attempt created.
+func (client *K360Client) create(ctx context.Context, url url.URL, data interface{}, exists func() (bool, error)) (*http.Response, error) {
+	return client.postWithRetry(ctx, url, data, func(err error, retryAfter time.Duration) (bool, error) {
+		if notProcessed(err, retryAfter) {
+			return false, nil
+		}
+		if exists == nil {
+			return false, &UncertainError{err}
+		}
+
+		found, existsErr := exists()
+		if existsErr != nil {
+			return false, &UncertainError{fmt.Errorf("%v, then failed to check whether it was processed: %v", err, existsErr)}
+		}
+		if found {
+			log.Printf("request to %v failed, but it was processed: %v\n", url.Path, err)
+		}
+		return found, nil
+	})
+}
+
+// postWithRetry sends data to the endpoint, repeating it on transient
+// failures. check, if set, is called before every repetition and can stop
+// it with an error or, when it returns true, with a nil response. Every
+// attempt is signed again as the signature contains a timestamp.
+func (client *K360Client) postWithRetry(ctx context.Context, url url.URL, data interface{}, check func(err error, retryAfter time.Duration) (bool, error)) (*http.Response, error) {
 	jsonBody, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
 
+	for attempt := 1; ; attempt++ {
+		if err := client.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		response, retryAfter, err := client.send(ctx, url, jsonBody)
+		if err == nil {
+			return response, nil
+		}
+
+		if !IsRetryable(err) {
+			return nil, err
+		}
+
+		if check != nil {
+			done, checkErr := check(err, retryAfter)
+			if checkErr != nil {
+				return nil, checkErr
+			}
+			if done {
+				return nil, nil
+			}
+		}
+
+		if attempt >= client.retry.MaxAttempts {
+			return nil, err
+		}
+
+		delay, ok := client.retry.delay(attempt, retryAfter)
+		if !ok {
+			log.Printf("request to %v failed, not retrying as Retry-After %v is longer than %v: %v\n", url.Path, retryAfter, client.retry.MaxDelay, err)
+			return nil, err
+		}
+		log.Printf("request to %v failed, retrying in %v: %v\n", url.Path, delay, err)
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (client *K360Client) send(ctx context.Context, url url.URL, jsonBody []byte) (*http.Response, time.Duration, error) {
 	timestampf := time.Now().Format("20060102150405")
 
 	h := hmac.New(sha256.New, []byte(client.apiKey))
@@ -118,19 +488,24 @@ func (client *K360Client) post(url url.URL, data interface{}) (*http.Response, e
 
 	url.RawQuery += fmt.Sprintf("timestamp=%s&signature=%s", timestampf, signature)
 
-	response, err := http.Post(url.String(), "application/json", bytes.NewBuffer(jsonBody))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", client.userAgent)
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	if response.StatusCode != 200 {
-		body, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			return nil, fmt.Errorf("bad response: code: %v", response.StatusCode)
-		} else {
-			return nil, fmt.Errorf("bad response: code: %v, body: %q", response.StatusCode, string(body))
-		}
+		defer response.Body.Close()
+
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, parseRetryAfter(response.Header.Get("Retry-After")), newAPIError(response.StatusCode, string(body))
 	}
 
-	return response, nil
+	return response, 0, nil
 }
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/k360/k360test"
+	"mrsydar/tkl/k360/vendor"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func newTestClient(t *testing.T, options ...Option) (*K360Client, *k360test.Server) {
+	server := k360test.NewServer("test-id", "test-key")
+	t.Cleanup(server.Close)
+
+	options = append([]Option{WithBaseURL(server.URL), WithRetry(fastRetry), WithRateLimit(0)}, options...)
+	return New("test-id", "test-key", options...), server
+}
+
+func TestGetCustomerIdFound(t *testing.T) {
+	client, server := newTestClient(t)
+	expected := server.AddCustomer(customer.Customer{Name: "ACME", Nip: "7792465289"})
+
+	actual, err := client.GetCustomerId(context.Background(), customer.Customer{Nip: "7792465289"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if actual != expected {
+		t.Fatalf("expected customer id %q, but got %q", expected, actual)
+	}
+}
+
+func TestGetCustomerIdNotFound(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	_, err := client.GetCustomerId(context.Background(), customer.Customer{Nip: "7792465289"})
+	if !errors.Is(err, customer.ErrNotFound) {
+		t.Fatalf("expected %v, but got %v", customer.ErrNotFound, err)
+	}
+}
+
+func TestPostCustomerAndInvoice(t *testing.T) {
+	client, server := newTestClient(t)
+
+	customerId, err := client.PostCustomer(context.Background(), customer.Customer{Name: "ACME", Nip: "7792465289"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	err = client.PostInvoice(context.Background(), invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "FV/1"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 1 || invoices[0].No != "FV/1" || invoices[0].Customer.Id != customerId {
+		t.Fatalf("unexpected invoices received by server: %v", invoices)
+	}
+}
+
+func TestVendorAndPurchaseInvoice(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if _, err := client.GetVendorId(context.Background(), vendor.Vendor{Nip: "7792465289"}); !errors.Is(err, vendor.ErrNotFound) {
+		t.Fatalf("expected %v, but got %v", vendor.ErrNotFound, err)
+	}
+
+	vendorId, err := client.PostVendor(context.Background(), vendor.Vendor{Name: "ACME", Nip: "7792465289"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	found, err := client.GetVendorId(context.Background(), vendor.Vendor{Nip: "7792465289"})
+	if err != nil || found != vendorId {
+		t.Fatalf("expected vendor id %q, but got %q, %v", vendorId, found, err)
+	}
+
+	err = client.PostPurchaseInvoice(context.Background(), invoice.Invoice{No: "ACME/1"}.PurchaseInvoice(vendorId))
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	invoices := server.PurchaseInvoices()
+	if len(invoices) != 1 || invoices[0].No != "ACME/1" || invoices[0].Vendor.Id != vendorId {
+		t.Fatalf("unexpected purchase invoices received by server: %v", invoices)
+	}
+}
+
+func TestPostCreditNote(t *testing.T) {
+	client, server := newTestClient(t)
+	customerId := server.AddCustomer(customer.Customer{Name: "ACME"})
+	server.AddInvoice(invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "FV/1"})
+
+	creditNote := invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "KOR/1"}.CreditNote("FV/1", "20220531120000", "price reduction")
+	if err := client.PostCreditNote(context.Background(), creditNote); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	creditNotes := server.CreditNotes()
+	if len(creditNotes) != 1 || creditNotes[0].No != "KOR/1" || creditNotes[0].OriginalNo != "FV/1" || creditNotes[0].Reason != "price reduction" {
+		t.Fatalf("unexpected credit notes received by server: %+v", creditNotes)
+	}
+
+	creditNote = invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "KOR/2"}.CreditNote("FV/2", "20220531120000", "price reduction")
+	if err := client.PostCreditNote(context.Background(), creditNote); !IsValidation(err) {
+		t.Fatalf("expected validation error for an unknown original invoice, but got %v", err)
+	}
+}
+
+func TestBadSignature(t *testing.T) {
+	_, server := newTestClient(t)
+	client := New("test-id", "wrong-key", WithBaseURL(server.URL))
+
+	_, err := client.GetCustomerId(context.Background(), customer.Customer{Nip: "7792465289"})
+	if err == nil {
+		t.Fatalf("error was expected")
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if err := client.VerifyCredentials(context.Background()); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	client = New("test-id", "wrong-key", WithBaseURL(server.URL), WithRateLimit(0))
+	if err := client.VerifyCredentials(context.Background()); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected %v, but got %v", ErrInvalidCredentials, err)
+	}
+}
+
+func TestGetTaxes(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	taxes, err := client.GetTaxes(context.Background())
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if len(taxes) == 0 || taxes[0].Id != "tax-23" || taxes[0].Pct != 23 {
+		t.Fatalf("unexpected taxes: %+v", taxes)
+	}
+}
+
+func TestBaseURLWithPath(t *testing.T) {
+	client := New("test-id", "test-key", WithBaseURL("http://localhost:8080/k360/"))
+
+	url, err := client.endpoint("api/v1/sendinvoice")
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	expected := "http://localhost:8080/k360/api/v1/sendinvoice?ApiId=test-id"
+	if url.String() != expected {
+		t.Fatalf("expected url %q, but got %q", expected, url.String())
+	}
+}
+
+func TestGetInvoicesLongPeriod(t *testing.T) {
+	client, server := newTestClient(t)
+	server.AddInvoice(invoice.Invoice{No: "FV/1", DocDate: "20220115120000"})
+	server.AddInvoice(invoice.Invoice{No: "FV/2", DocDate: "20220531120000"})
+	server.AddInvoice(invoice.Invoice{No: "FV/3", DocDate: "20220601000000"})
+
+	from := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 5, 31, 8, 0, 0, 0, time.UTC)
+
+	invoices, err := client.GetInvoices(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if len(invoices) != 2 || invoices[0].No != "FV/1" || invoices[1].No != "FV/2" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	client, server := newTestClient(t)
+	server.FailRequests(2, http.StatusServiceUnavailable, "")
+
+	_, err := client.GetTaxes(context.Background())
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if requests := server.Requests(); requests != 3 {
+		t.Fatalf("expected 3 requests, but got %v", requests)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	client, server := newTestClient(t)
+	server.FailRequests(3, http.StatusTooManyRequests, "")
+
+	_, err := client.PostCustomer(context.Background(), customer.Customer{Name: "ACME"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected error with status %v, but got %v", http.StatusTooManyRequests, err)
+	}
+
+	if len(server.Customers()) != 0 {
+		t.Fatalf("customer was not expected to be created")
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	client, server := newTestClient(t)
+
+	_, err := client.PostCustomer(context.Background(), customer.Customer{})
+	if err == nil {
+		t.Fatalf("error was expected")
+	}
+
+	if requests := server.Requests(); requests != 1 {
+		t.Fatalf("expected 1 request, but got %v", requests)
+	}
+}
+
+func TestRetryCreateNotProcessed(t *testing.T) {
+	client, server := newTestClient(t, WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Minute}))
+	customerId := server.AddCustomer(customer.Customer{Name: "ACME"})
+	server.FailRequests(1, http.StatusInternalServerError, "")
+	server.FailRequests(1, http.StatusServiceUnavailable, "1")
+
+	err := client.PostInvoice(context.Background(), invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "FV/1", DocDate: "20220531120000"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	// the 500 is checked with a lookup, the 503 with Retry-After is repeated
+	// after the second it asks for
+	if requests, invoices := server.Requests(), server.Invoices(); requests != 4 || len(invoices) != 1 {
+		t.Fatalf("expected 4 requests and 1 invoice, but got %v and %+v", requests, invoices)
+	}
+}
+
+func TestRetryCreateProcessed(t *testing.T) {
+	client, server := newTestClient(t)
+	customerId := server.AddCustomer(customer.Customer{Name: "ACME"})
+	server.FailResponses(1, http.StatusInternalServerError)
+
+	err := client.PostInvoice(context.Background(), invoice.Invoice{Customer: invoice.Customer{Id: customerId}, No: "FV/1", DocDate: "20220531120000"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 1 {
+		t.Fatalf("invoice was posted %v times", len(invoices))
+	}
+
+	server.FailResponses(1, http.StatusBadGateway)
+	customerId, err = client.PostCustomer(context.Background(), customer.Customer{Name: "KNOWN", Nip: "7792465289"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if customers := server.Customers(); len(customers) != 2 || customers[1].Id != customerId {
+		t.Fatalf("unexpected customers: %+v, id %q", customers, customerId)
+	}
+}
+
+func TestRetryCreateUncertain(t *testing.T) {
+	client, server := newTestClient(t)
+	vendorId := server.AddVendor(vendor.Vendor{Name: "ACME"})
+	server.FailResponses(1, http.StatusInternalServerError)
+
+	err := client.PostPurchaseInvoice(context.Background(), invoice.Invoice{No: "ACME/1"}.PurchaseInvoice(vendorId))
+
+	var uncertainErr *UncertainError
+	if !errors.As(err, &uncertainErr) || !hasStatus(err, http.StatusInternalServerError) {
+		t.Fatalf("expected uncertain error with status %v, but got %v", http.StatusInternalServerError, err)
+	}
+
+	if requests := server.Requests(); requests != 1 {
+		t.Fatalf("expected 1 request, but got %v", requests)
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	client, server := newTestClient(t, WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Minute}))
+	server.FailRequests(1, http.StatusTooManyRequests, "1")
+
+	start := time.Now()
+	_, err := client.PostCustomer(context.Background(), customer.Customer{Name: "ACME"})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected to wait for Retry-After, but retried after %v", elapsed)
+	}
+}
+
+func TestRetryAfterLongerThanMaxDelay(t *testing.T) {
+	client, server := newTestClient(t, WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+	server.FailRequests(1, http.StatusTooManyRequests, "60")
+
+	start := time.Now()
+	_, err := client.GetTaxes(context.Background())
+	if !hasStatus(err, http.StatusTooManyRequests) {
+		t.Fatalf("expected error with status %v, but got %v", http.StatusTooManyRequests, err)
+	}
+
+	if elapsed, requests := time.Since(start), server.Requests(); elapsed > time.Second || requests != 1 {
+		t.Fatalf("expected to give up at once, but made %v requests in %v", requests, elapsed)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	client, server := newTestClient(t, WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Minute}))
+	server.FailRequests(1, http.StatusBadGateway, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetTaxes(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	client, _ := newTestClient(t, WithRateLimit(20))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := client.PostCustomer(context.Background(), customer.Customer{Name: "ACME"}); err != nil {
+			t.Fatalf("error was not expected: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected requests to be spread over at least 200ms, but took %v", elapsed)
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIError is returned for every non-200 response of the Księgowość360 API.
+// Message and Fields are parsed from the response body when it's a JSON
+// error, Fields maps invalid fields to their problems.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Message    string
+	Fields     map[string][]string
+}
+
+func newAPIError(statusCode int, body string) *APIError {
+	err := &APIError{StatusCode: statusCode, Body: body}
+
+	parsed := struct {
+		Message    string              `json:"Message"`
+		Error      string              `json:"error"`
+		ModelState map[string][]string `json:"ModelState"`
+	}{}
+	if json.Unmarshal([]byte(body), &parsed) == nil {
+		err.Message = parsed.Message
+		if err.Message == "" {
+			err.Message = parsed.Error
+		}
+		if len(parsed.ModelState) != 0 {
+			err.Fields = parsed.ModelState
+		}
+	} else {
+		err.Message = strings.TrimSpace(body)
+	}
+
+	return err
+}
+
+func (err *APIError) Error() string {
+	if err.Message == "" && len(err.Fields) == 0 {
+		if err.Body == "" {
+			return fmt.Sprintf("bad response: code: %v", err.StatusCode)
+		}
+		return fmt.Sprintf("bad response: code: %v, body: %q", err.StatusCode, err.Body)
+	}
+
+	message := fmt.Sprintf("bad response: code: %v", err.StatusCode)
+	if err.Message != "" {
+		message += ": " + err.Message
+	}
+
+	fields := make([]string, 0, len(err.Fields))
+	for field := range err.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		message += fmt.Sprintf("; %v: %v", field, strings.Join(err.Fields[field], ", "))
+	}
+
+	return message
+}
+
+func hasStatus(err error, statusCodes ...int) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	for _, statusCode := range statusCodes {
+		if apiErr.StatusCode == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAuthError reports whether the request was rejected because of bad API
+// credentials or signature, no other request will succeed then.
+func IsAuthError(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized, http.StatusForbidden)
+}
+
+// IsValidation reports whether the API rejected the sent data.
+func IsValidation(err error) bool {
+	return hasStatus(err, http.StatusBadRequest, http.StatusUnprocessableEntity)
+}
+
+// IsRetryable reports whether the request failed with a transient error,
+// i.e. a network error, 429 or 5xx response.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// notProcessed reports whether a failed request certainly didn't reach the
+// API or was refused before being processed, so sending it again can't
+// create anything twice.
+func notProcessed(err error, retryAfter time.Duration) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			(apiErr.StatusCode == http.StatusServiceUnavailable && retryAfter > 0)
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// UncertainError is returned when a request creating an invoice, customer
+// or vendor failed in a way which doesn't tell whether the API processed
+// it. It isn't repeated, as that could create a duplicate.
+type UncertainError struct {
+	Err error
+}
+
+func (err *UncertainError) Error() string {
+	return fmt.Sprintf("%v; it may have been processed, check Księgowość360 before sending it again", err.Err)
+}
+
+func (err *UncertainError) Unwrap() error {
+	return err.Err
+}
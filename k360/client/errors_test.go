@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorParsesBody(t *testing.T) {
+	err := newAPIError(http.StatusBadRequest, `{"Message":"The request is invalid.","ModelState":{"TotalAmount":["must be positive"],"InvoiceNo":["is required","is too long"]}}`)
+
+	if err.Message != "The request is invalid." || len(err.Fields) != 2 || len(err.Fields["InvoiceNo"]) != 2 {
+		t.Fatalf("unexpected parsed error: %+v", err)
+	}
+
+	expected := "bad response: code: 400: The request is invalid.; InvoiceNo: is required, is too long; TotalAmount: must be positive"
+	if err.Error() != expected {
+		t.Fatalf("expected %q, but got %q", expected, err.Error())
+	}
+}
+
+func TestAPIErrorPlainBody(t *testing.T) {
+	err := newAPIError(http.StatusUnauthorized, "api-authentication failed\n")
+
+	if err.Message != "api-authentication failed" || err.Fields != nil {
+		t.Fatalf("unexpected parsed error: %+v", err)
+	}
+}
+
+func TestAPIErrorKinds(t *testing.T) {
+	wrap := func(statusCode int) error {
+		return fmt.Errorf("failed: %w", newAPIError(statusCode, ""))
+	}
+
+	tests := []struct {
+		err        error
+		auth       bool
+		validation bool
+		retryable  bool
+	}{
+		{wrap(http.StatusUnauthorized), true, false, false},
+		{wrap(http.StatusForbidden), true, false, false},
+		{wrap(http.StatusBadRequest), false, true, false},
+		{wrap(http.StatusUnprocessableEntity), false, true, false},
+		{wrap(http.StatusTooManyRequests), false, false, true},
+		{wrap(http.StatusBadGateway), false, false, true},
+		{&url.Error{Op: "Post", URL: "http://localhost", Err: errors.New("connection refused")}, false, false, true},
+		{errors.New("too many customers found"), false, false, false},
+	}
+
+	for _, test := range tests {
+		if IsAuthError(test.err) != test.auth || IsValidation(test.err) != test.validation || IsRetryable(test.err) != test.retryable {
+			t.Errorf("unexpected kind of %v", test.err)
+		}
+	}
+}
+
+func TestNotProcessed(t *testing.T) {
+	dial := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	read := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+
+	tests := []struct {
+		err        error
+		retryAfter time.Duration
+		expected   bool
+	}{
+		{dial, 0, true},
+		{read, 0, false},
+		{&url.Error{Op: "Post", URL: "http://localhost", Err: context.DeadlineExceeded}, 0, false},
+		{newAPIError(http.StatusTooManyRequests, ""), 0, true},
+		{newAPIError(http.StatusServiceUnavailable, ""), time.Second, true},
+		{newAPIError(http.StatusServiceUnavailable, ""), 0, false},
+		{newAPIError(http.StatusInternalServerError, ""), time.Second, false},
+	}
+
+	for _, test := range tests {
+		if actual := notProcessed(test.err, test.retryAfter); actual != test.expected {
+			t.Errorf("expected %v for %v with Retry-After %v, but got %v", test.expected, test.err, test.retryAfter, actual)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy describes how requests failed with transient errors (network
+// errors, 429 and 5xx responses) are repeated. Requests creating invoices,
+// customers or vendors are only repeated when they weren't processed.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// NoRetry makes every request at most once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+const DefaultRateLimit = 5
+
+func WithRetry(policy RetryPolicy) Option {
+	return func(client *K360Client) {
+		client.retry = policy
+	}
+}
+
+// WithRateLimit limits the client to the given number of requests per
+// second. Zero disables the limit.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(client *K360Client) {
+		client.limiter = newRateLimiter(requestsPerSecond)
+	}
+}
+
+// delay returns how long to wait before the given attempt (counted from 1
+// for the first retry). Retry-After sent by the server takes precedence over
+// the exponential backoff, when it's longer than MaxDelay the request must
+// not be repeated and ok is false.
+func (policy RetryPolicy) delay(attempt int, retryAfter time.Duration) (delay time.Duration, ok bool) {
+	if retryAfter > 0 {
+		if policy.MaxDelay > 0 && retryAfter > policy.MaxDelay {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+
+	delay = policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || (policy.MaxDelay > 0 && delay > policy.MaxDelay) {
+		delay = policy.MaxDelay
+	}
+
+	// full jitter in the upper half keeps concurrent workers from retrying
+	// at the same moment
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	return delay, true
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimiter spaces requests evenly, it is shared by all goroutines using
+// the client.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(requestsPerSecond float64) *rateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+func (limiter *rateLimiter) wait(ctx context.Context) error {
+	if limiter == nil {
+		return nil
+	}
+
+	limiter.mu.Lock()
+	now := time.Now()
+	slot := limiter.next
+	if slot.Before(now) {
+		slot = now
+	}
+	limiter.next = slot.Add(limiter.interval)
+	limiter.mu.Unlock()
+
+	return sleep(ctx, time.Until(slot))
+}
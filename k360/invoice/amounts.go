@@ -0,0 +1,78 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	AmountPlaces    = 2
+	UnitPricePlaces = 4
+)
+
+var hundred = NewDecimal(100)
+
+// Line holds the amounts of one invoice row. Net, Tax and Gross are values
+// of the whole row, UnitPrice is the net price of a single unit.
+type Line struct {
+	Quantity  Decimal
+	UnitPrice Decimal
+	Net       Decimal
+	Tax       Decimal
+	Gross     Decimal
+}
+
+// LineFromNet derives the line from its net value and tax, as in invoices.
+func LineFromNet(net, tax, quantity Decimal) (Line, error) {
+	if quantity.Sign() <= 0 {
+		return Line{}, errors.New("quantity must be positive")
+	}
+
+	net = net.Grosze()
+	tax = tax.Grosze()
+
+	return newLine(quantity, net, tax, net.Add(tax))
+}
+
+// LineFromGross derives the line from its gross value and VAT rate in
+// percent, as in receipts. The tax is rounded and the net value is what's
+// left of the gross value, so they always add up.
+func LineFromGross(gross, ratePct, quantity Decimal) (Line, error) {
+	if quantity.Sign() <= 0 {
+		return Line{}, errors.New("quantity must be positive")
+	}
+
+	gross = gross.Grosze()
+	tax := gross.Mul(ratePct).Div(hundred.Add(ratePct)).Grosze()
+	net := gross.Sub(tax)
+
+	return newLine(quantity, net, tax, gross)
+}
+
+// newLine sets the unit price of the line. Księgowość360 calculates the net
+// value of a row as quantity times price, so lines whose rounded unit price
+// doesn't give back the net value are rejected.
+func newLine(quantity, net, tax, gross Decimal) (Line, error) {
+	unitPrice := net.Div(quantity).Round(UnitPricePlaces)
+	if rowNet := quantity.Mul(unitPrice).Grosze(); rowNet.Cmp(net) != 0 {
+		return Line{}, fmt.Errorf("net value %v isn't %v times a unit price with %v decimal places (%v)", net, quantity, UnitPricePlaces, rowNet)
+	}
+
+	return Line{
+		Quantity:  quantity,
+		UnitPrice: unitPrice,
+		Net:       net,
+		Tax:       tax,
+		Gross:     gross,
+	}, nil
+}
+
+// Row returns the invoice row of the line.
+func (line Line) Row(taxId string, item Item) Row {
+	return Row{
+		TaxId:    taxId,
+		Item:     item,
+		Quantity: line.Quantity,
+		Price:    line.UnitPrice,
+	}
+}
@@ -0,0 +1,48 @@
+package invoice
+
+import "testing"
+
+func TestLineFromGross(t *testing.T) {
+	tests := []struct {
+		gross, rate, quantity string
+		net, tax, unitPrice   string
+	}{
+		{"123.00", "23", "1", "100.00", "23.00", "100.00"},
+		{"10.00", "8", "1", "9.26", "0.74", "9.26"},
+		{"100.00", "0", "3", "100.00", "0.00", "33.3333"},
+	}
+
+	for _, test := range tests {
+		line, err := LineFromGross(mustParse(t, test.gross), mustParse(t, test.rate), mustParse(t, test.quantity))
+		if err != nil {
+			t.Fatalf("error was not expected: %v", err)
+		}
+
+		if line.Net.String() != test.net || line.Tax.String() != test.tax || line.UnitPrice.String() != test.unitPrice || line.Net.Add(line.Tax).Cmp(line.Gross) != 0 {
+			t.Errorf("%v at %v%%: unexpected line %v", test.gross, test.rate, line)
+		}
+	}
+
+	if _, err := LineFromGross(mustParse(t, "1"), mustParse(t, "23"), Decimal{}); err == nil {
+		t.Fatalf("error was expected for zero quantity")
+	}
+}
+
+func TestLineFromNet(t *testing.T) {
+	line, err := LineFromNet(mustParse(t, "100.00"), mustParse(t, "23.00"), mustParse(t, "3"))
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if line.Gross.String() != "123.00" || line.UnitPrice.String() != "33.3333" {
+		t.Fatalf("unexpected line %v", line)
+	}
+
+	if line.Quantity.Mul(line.UnitPrice).Grosze().Cmp(line.Net) != 0 {
+		t.Fatalf("quantity times unit price of %v doesn't give the net value", line)
+	}
+
+	if _, err := LineFromNet(mustParse(t, "1.00"), mustParse(t, "0.23"), mustParse(t, "300")); err == nil {
+		t.Fatalf("error was expected for a unit price which doesn't give back the net value")
+	}
+}
@@ -0,0 +1,177 @@
+package invoice
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const maxDecimalPlaces = 8
+
+var (
+	decimalRegex = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	groupedRegex = regexp.MustCompile(`^-?[0-9]{1,3}(,[0-9]{3})+$`)
+)
+
+// Decimal is an exact decimal number used for amounts, quantities and
+// prices. The zero value is 0.
+type Decimal struct {
+	rat *big.Rat
+}
+
+func NewDecimal(value int64) Decimal {
+	return Decimal{big.NewRat(value, 1)}
+}
+
+func ParseDecimal(value string) (Decimal, error) {
+	value = strings.TrimSpace(value)
+	if !decimalRegex.MatchString(value) {
+		return Decimal{}, fmt.Errorf("%q is not a decimal number", value)
+	}
+
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%q is not a decimal number", value)
+	}
+	return Decimal{rat}, nil
+}
+
+// ParseAmount parses amounts written the Polish or the English way, e.g.
+// 1234.5, 1 234,50, 1.234,50 or 1,234.50. A single comma or dot is always
+// the decimal separator, so 1,234 is 1.234.
+func ParseAmount(value string) (Decimal, error) {
+	normalized := strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(strings.TrimSpace(value))
+
+	comma, dot := strings.LastIndex(normalized, ","), strings.LastIndex(normalized, ".")
+	integer, fraction := normalized, ""
+	switch {
+	case comma > dot && strings.Count(normalized, ",") == 1:
+		integer, fraction = normalized[:comma], normalized[comma+1:]
+	case dot > comma && strings.Count(normalized, ".") == 1:
+		integer, fraction = normalized[:dot], normalized[dot+1:]
+	}
+
+	// what's left of the integer part may only have thousands separators
+	// other than the decimal one
+	if strings.ContainsAny(integer, ",.") {
+		grouped := strings.ReplaceAll(integer, ".", ",")
+		if (strings.Contains(integer, ",") && strings.Contains(integer, ".")) || !groupedRegex.MatchString(grouped) {
+			return Decimal{}, fmt.Errorf("%q is not an amount like 1234.50 or 1 234,50", value)
+		}
+		integer = strings.ReplaceAll(grouped, ",", "")
+	}
+
+	if fraction != "" || strings.HasSuffix(normalized, ",") || strings.HasSuffix(normalized, ".") {
+		normalized = integer + "." + fraction
+	} else {
+		normalized = integer
+	}
+
+	d, err := ParseDecimal(normalized)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("%q is not an amount like 1234.50 or 1 234,50", value)
+	}
+	return d, nil
+}
+
+func (d Decimal) value() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return d.rat
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	return Decimal{new(big.Rat).Add(d.value(), other.value())}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return Decimal{new(big.Rat).Sub(d.value(), other.value())}
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{new(big.Rat).Mul(d.value(), other.value())}
+}
+
+// Div returns d / other, which must not be zero.
+func (d Decimal) Div(other Decimal) Decimal {
+	return Decimal{new(big.Rat).Quo(d.value(), other.value())}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{new(big.Rat).Abs(d.value())}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{new(big.Rat).Neg(d.value())}
+}
+
+// Round rounds to the given number of decimal places, halves away from
+// zero (half-up as in the VAT act, so -0.125 is -0.13).
+func (d Decimal) Round(places int) Decimal {
+	rounded, _ := new(big.Rat).SetString(d.value().FloatString(places))
+	return Decimal{rounded}
+}
+
+// Grosze rounds an amount in złoty to whole grosze.
+func (d Decimal) Grosze() Decimal {
+	return d.Round(AmountPlaces)
+}
+
+// HasPlaces reports whether the number has at most the given number of decimal
+// places.
+func (d Decimal) HasPlaces(places int) bool {
+	return d.Round(places).Cmp(d) == 0
+}
+
+func (d Decimal) Cmp(other Decimal) int {
+	return d.value().Cmp(other.value())
+}
+
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// String formats the number with as many decimal places as it needs, but at
+// least two, e.g. 1.00, 33.3333.
+func (d Decimal) String() string {
+	value := d.value()
+	for places := 2; places < maxDecimalPlaces; places++ {
+		shifted := new(big.Rat).Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)))
+		if shifted.IsInt() {
+			return value.FloatString(places)
+		}
+	}
+	return value.FloatString(maxDecimalPlaces)
+}
+
+// MarshalJSON writes the number as a JSON number like 123.40, as
+// Księgowość360 expects.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts both numbers and strings with numbers.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return err
+		}
+		value = number.String()
+	}
+
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,84 @@
+package invoice
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustParse(t *testing.T, value string) Decimal {
+	d, err := ParseDecimal(value)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	return d
+}
+
+func TestDecimalRoundAndString(t *testing.T) {
+	tests := []struct {
+		value    string
+		places   int
+		expected string
+	}{
+		{"1", 2, "1.00"},
+		{"0.125", 2, "0.13"},
+		{"-0.125", 2, "-0.13"},
+		{"33.33333", 4, "33.3333"},
+		{"2.675", 2, "2.68"},
+	}
+
+	for _, test := range tests {
+		if actual := mustParse(t, test.value).Round(test.places).String(); actual != test.expected {
+			t.Errorf("%v rounded to %v places: expected %v, but got %v", test.value, test.places, test.expected, actual)
+		}
+	}
+
+	for _, value := range []string{"", "1,5", "1e3", "abc", "."} {
+		if _, err := ParseDecimal(value); err == nil {
+			t.Errorf("%q: error was expected", value)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var row Row
+	if err := json.Unmarshal([]byte(`{"Quantity": 1.5, "Price": "10.25"}`), &row); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	data, err := json.Marshal(TaxAmount{Amount: row.Price.Mul(row.Quantity)})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if string(data) != `{"TaxId":"","Amount":15.375}` {
+		t.Fatalf("unexpected json: %s", data)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]string{
+		"12.50":        "12.50",
+		"12,50":        "12.50",
+		"1 234,00":     "1234.00",
+		"1\u00a0234,5": "1234.50",
+		"1.234,56":     "1234.56",
+		"1,234.56":     "1234.56",
+		"1,234,567":    "1234567.00",
+		"1.234.567,8":  "1234567.80",
+		"-0,01":        "-0.01",
+		"1,234":        "1.234",
+		"100":          "100.00",
+	}
+
+	for value, expected := range tests {
+		d, err := ParseAmount(value)
+		if err != nil || d.String() != expected {
+			t.Errorf("%q: expected %v, but got %v, %v", value, expected, d, err)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "12,", "1,2,3", "1.234,567.8", "1,23,456", "12 zł"} {
+		if _, err := ParseAmount(value); err == nil {
+			t.Errorf("%q: error was expected", value)
+		}
+	}
+}
@@ -10,17 +10,20 @@ type Item struct {
 }
 
 type Row struct {
-	TaxId    string `json:"TaxId"`
-	Item     Item   `json:"Item"`
-	Quantity string `json:"Quantity"`
-	Price    string `json:"Price"`
+	TaxId    string  `json:"TaxId"`
+	Item     Item    `json:"Item"`
+	Quantity Decimal `json:"Quantity"`
+	Price    Decimal `json:"Price"`
 }
 
 type TaxAmount struct {
-	TaxId  string `json:"TaxId"`
-	Amount string `json:"Amount"`
+	TaxId  string  `json:"TaxId"`
+	Amount Decimal `json:"Amount"`
 }
 
+// Invoice is a sales invoice, its TotalAmount is the gross total, i.e. the
+// amount to pay. Amounts are in CurrencyCode, PLN when it's empty, and CurrencyRate
+// is the PLN value of one unit of the currency.
 type Invoice struct {
 	Customer        Customer    `json:"Customer"`
 	DocDate         string      `json:"DocDate"`
@@ -29,5 +32,83 @@ type Invoice struct {
 	No              string      `json:"InvoiceNo"`
 	Rows            []Row       `json:"InvoiceRow"`
 	TaxAmounts      []TaxAmount `json:"TaxAmount"`
-	TotalAmount     string      `json:"TotalAmount"`
+	TotalAmount     Decimal     `json:"TotalAmount"`
+	CurrencyCode    string      `json:"CurrencyCode,omitempty"`
+	CurrencyRate    *Decimal    `json:"CurrencyRate,omitempty"`
+}
+
+// AmountsInPLN returns the net total and the sum of taxes converted to PLN
+// and rounded to grosze.
+func (invoice Invoice) AmountsInPLN() (net, tax Decimal) {
+	rate := NewDecimal(1)
+	if invoice.CurrencyRate != nil {
+		rate = *invoice.CurrencyRate
+	}
+
+	for _, amount := range invoice.TaxAmounts {
+		tax = tax.Add(amount.Amount)
+	}
+	net = invoice.TotalAmount.Sub(tax)
+	return net.Mul(rate).Grosze(), tax.Mul(rate).Grosze()
+}
+
+// CreditNote is a correction (faktura korygująca) of the invoice OriginalNo
+// issued on OriginalDate. Its rows and amounts are the differences to the
+// original invoice, negative when its value decreases.
+type CreditNote struct {
+	Invoice
+	OriginalNo   string `json:"OriginalInvoiceNo"`
+	OriginalDate string `json:"OriginalDocDate"`
+	Reason       string `json:"CorrectionReason"`
+}
+
+// CreditNote returns the invoice as a correction of the original invoice.
+func (invoice Invoice) CreditNote(originalNo, originalDate, reason string) CreditNote {
+	return CreditNote{
+		Invoice:      invoice,
+		OriginalNo:   originalNo,
+		OriginalDate: originalDate,
+		Reason:       reason,
+	}
+}
+
+type Vendor struct {
+	Id string `json:"Id"`
+}
+
+// PurchaseInvoice is a cost invoice received from a vendor, No is the
+// vendor's number of the invoice.
+type PurchaseInvoice struct {
+	Vendor          Vendor      `json:"Vendor"`
+	DocDate         string      `json:"DocDate"`
+	DueDate         string      `json:"DueDate"`
+	TransactionDate string      `json:"TransactionDate"`
+	No              string      `json:"BillNo"`
+	Rows            []Row       `json:"InvoiceRow"`
+	TaxAmounts      []TaxAmount `json:"TaxAmount"`
+	TotalAmount     Decimal     `json:"TotalAmount"`
+	CurrencyCode    string      `json:"CurrencyCode,omitempty"`
+	CurrencyRate    *Decimal    `json:"CurrencyRate,omitempty"`
+}
+
+// PurchaseInvoice returns the invoice as received from the vendor.
+func (invoice Invoice) PurchaseInvoice(vendorId string) PurchaseInvoice {
+	return PurchaseInvoice{
+		Vendor:          Vendor{Id: vendorId},
+		DocDate:         invoice.DocDate,
+		DueDate:         invoice.DueDate,
+		TransactionDate: invoice.TransactionDate,
+		No:              invoice.No,
+		Rows:            invoice.Rows,
+		TaxAmounts:      invoice.TaxAmounts,
+		TotalAmount:     invoice.TotalAmount,
+		CurrencyCode:    invoice.CurrencyCode,
+		CurrencyRate:    invoice.CurrencyRate,
+	}
+}
+
+type Summary struct {
+	Id      string `json:"SIHId"`
+	No      string `json:"InvoiceNo"`
+	DocDate string `json:"DocumentDate"`
 }
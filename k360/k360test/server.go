@@ -0,0 +1,531 @@
+package k360test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/k360/tax"
+	"mrsydar/tkl/k360/vendor"
+)
+
+const maxClockSkew = 5 * time.Minute
+
+// Server is a local stand-in for the Księgowość360 API. It checks request
+// signatures the same way the real service does and records every accepted
+// payload.
+type Server struct {
+	URL string
+
+	apiId  string
+	apiKey string
+	server *httptest.Server
+
+	mu               sync.Mutex
+	nextId           int
+	customers        []customer.Customer
+	vendors          []vendor.Vendor
+	invoices         []invoice.Invoice
+	creditNotes      []invoice.CreditNote
+	purchaseInvoices []invoice.PurchaseInvoice
+	rejectedInvoices map[string]string
+	failures         []failure
+	requests         int
+}
+
+type failure struct {
+	statusCode int
+	retryAfter string
+	processed  bool
+}
+
+func NewServer(apiId, apiKey string) *Server {
+	s := &Server{
+		apiId:            apiId,
+		apiKey:           apiKey,
+		rejectedInvoices: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/getcustomers", s.authenticated(s.getCustomers))
+	mux.HandleFunc("/api/v2/sendcustomer", s.authenticated(s.sendCustomer))
+	mux.HandleFunc("/api/v1/sendinvoice", s.authenticated(s.sendInvoice))
+	mux.HandleFunc("/api/v1/sendcreditinvoice", s.authenticated(s.sendCreditInvoice))
+	mux.HandleFunc("/api/v1/getvendors", s.authenticated(s.getVendors))
+	mux.HandleFunc("/api/v2/sendvendor", s.authenticated(s.sendVendor))
+	mux.HandleFunc("/api/v1/sendpurchinvoice", s.authenticated(s.sendPurchaseInvoice))
+	mux.HandleFunc("/api/v1/getinvoices", s.authenticated(s.getInvoices))
+	mux.HandleFunc("/api/v1/gettaxes", s.authenticated(s.getTaxes))
+
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) AddCustomer(data customer.Customer) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addCustomer(data)
+}
+
+func (s *Server) AddVendor(data vendor.Vendor) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addVendor(data)
+}
+
+// AddInvoice stores an invoice as if it was posted before, without any
+// checks.
+func (s *Server) AddInvoice(data invoice.Invoice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invoices = append(s.invoices, data)
+}
+
+func (s *Server) RejectInvoice(no, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rejectedInvoices[no] = message
+}
+
+// FailRequests makes the next count requests fail with the given status
+// code after they pass authentication. retryAfter, if not empty, is sent in
+// the Retry-After header.
+func (s *Server) FailRequests(count, statusCode int, retryAfter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, failure{statusCode, retryAfter, false})
+	}
+}
+
+// FailResponses makes the next count requests fail with the given status
+// code after they were processed, as if the response was lost.
+func (s *Server) FailResponses(count, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, failure{statusCode, "", true})
+	}
+}
+
+// Requests returns the number of authenticated requests received so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) Customers() []customer.Customer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]customer.Customer(nil), s.customers...)
+}
+
+func (s *Server) Invoices() []invoice.Invoice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]invoice.Invoice(nil), s.invoices...)
+}
+
+func (s *Server) CreditNotes() []invoice.CreditNote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]invoice.CreditNote(nil), s.creditNotes...)
+}
+
+func (s *Server) Vendors() []vendor.Vendor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]vendor.Vendor(nil), s.vendors...)
+}
+
+func (s *Server) PurchaseInvoices() []invoice.PurchaseInvoice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]invoice.PurchaseInvoice(nil), s.purchaseInvoices...)
+}
+
+func (s *Server) addVendor(data vendor.Vendor) string {
+	s.nextId++
+	data.Id = fmt.Sprintf("vendor-%d", s.nextId)
+	s.vendors = append(s.vendors, data)
+	return data.Id
+}
+
+func (s *Server) findVendor(id string) bool {
+	for _, v := range s.vendors {
+		if v.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) addCustomer(data customer.Customer) string {
+	s.nextId++
+	data.Id = fmt.Sprintf("customer-%d", s.nextId)
+	s.customers = append(s.customers, data)
+	return data.Id
+}
+
+func (s *Server) findCustomer(id string) bool {
+	for _, c := range s.customers {
+		if c.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) authenticated(handler func(w http.ResponseWriter, body []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := s.verifySignature(r, body); err != nil {
+			http.Error(w, fmt.Sprintf("api-authentication failed: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		if failure, ok := s.nextFailure(); ok {
+			if failure.processed {
+				handler(httptest.NewRecorder(), body)
+			}
+			if failure.retryAfter != "" {
+				w.Header().Set("Retry-After", failure.retryAfter)
+			}
+			http.Error(w, http.StatusText(failure.statusCode), failure.statusCode)
+			return
+		}
+
+		handler(w, body)
+	}
+}
+
+func (s *Server) nextFailure() (failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(s.failures) == 0 {
+		return failure{}, false
+	}
+
+	next := s.failures[0]
+	s.failures = s.failures[1:]
+	return next, true
+}
+
+func (s *Server) verifySignature(r *http.Request, body []byte) error {
+	query := r.URL.Query()
+
+	if query.Get("ApiId") != s.apiId {
+		return fmt.Errorf("unknown ApiId %q", query.Get("ApiId"))
+	}
+
+	timestampf := query.Get("timestamp")
+	timestamp, err := time.ParseInLocation("20060102150405", timestampf, time.Local)
+	if err != nil {
+		return fmt.Errorf("bad timestamp %q", timestampf)
+	}
+	if skew := time.Since(timestamp); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("timestamp %q expired", timestampf)
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return fmt.Errorf("bad signature encoding")
+	}
+
+	h := hmac.New(sha256.New, []byte(s.apiKey))
+	h.Write([]byte(s.apiId + timestampf + string(body)))
+	if !hmac.Equal(signature, h.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+func (s *Server) getCustomers(w http.ResponseWriter, body []byte) {
+	var query customer.Customer
+	if err := json.Unmarshal(body, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type foundCustomer struct {
+		Id   string `json:"CustomerId"`
+		Name string `json:"Name"`
+	}
+	found := make([]foundCustomer, 0)
+	for _, c := range s.customers {
+		if (query.Nip == "" || c.Nip == query.Nip) && (query.Name == "" || c.Name == query.Name) {
+			found = append(found, foundCustomer{c.Id, c.Name})
+		}
+	}
+
+	writeJson(w, found)
+}
+
+func (s *Server) sendCustomer(w http.ResponseWriter, body []byte) {
+	var data customer.Customer
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if data.Name == "" {
+		http.Error(w, "customer name is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJson(w, struct {
+		Id string `json:"Id"`
+	}{s.addCustomer(data)})
+}
+
+func (s *Server) sendInvoice(w http.ResponseWriter, body []byte) {
+	var data invoice.Invoice
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message, ok := s.rejectedInvoices[data.No]; ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !s.findCustomer(data.Customer.Id) {
+		http.Error(w, fmt.Sprintf("customer %q not found", data.Customer.Id), http.StatusBadRequest)
+		return
+	}
+
+	s.invoices = append(s.invoices, data)
+
+	writeJson(w, struct {
+		CustomerId string `json:"CustomerId"`
+		InvoiceNo  string `json:"InvoiceNo"`
+	}{data.Customer.Id, data.No})
+}
+
+func (s *Server) getVendors(w http.ResponseWriter, body []byte) {
+	var query vendor.Vendor
+	if err := json.Unmarshal(body, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type foundVendor struct {
+		Id   string `json:"VendorId"`
+		Name string `json:"Name"`
+	}
+	found := make([]foundVendor, 0)
+	for _, v := range s.vendors {
+		if (query.Nip == "" || v.Nip == query.Nip) && (query.Name == "" || v.Name == query.Name) {
+			found = append(found, foundVendor{v.Id, v.Name})
+		}
+	}
+
+	writeJson(w, found)
+}
+
+func (s *Server) sendVendor(w http.ResponseWriter, body []byte) {
+	var data vendor.Vendor
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if data.Name == "" {
+		http.Error(w, "vendor name is required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJson(w, struct {
+		Id string `json:"Id"`
+	}{s.addVendor(data)})
+}
+
+func (s *Server) sendPurchaseInvoice(w http.ResponseWriter, body []byte) {
+	var data invoice.PurchaseInvoice
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message, ok := s.rejectedInvoices[data.No]; ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !s.findVendor(data.Vendor.Id) {
+		http.Error(w, fmt.Sprintf("vendor %q not found", data.Vendor.Id), http.StatusBadRequest)
+		return
+	}
+
+	s.purchaseInvoices = append(s.purchaseInvoices, data)
+
+	writeJson(w, struct {
+		VendorId string `json:"VendorId"`
+		BillNo   string `json:"BillNo"`
+	}{data.Vendor.Id, data.No})
+}
+
+func (s *Server) sendCreditInvoice(w http.ResponseWriter, body []byte) {
+	var data invoice.CreditNote
+	if err := json.Unmarshal(body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message, ok := s.rejectedInvoices[data.No]; ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !s.findCustomer(data.Customer.Id) {
+		http.Error(w, fmt.Sprintf("customer %q not found", data.Customer.Id), http.StatusBadRequest)
+		return
+	}
+
+	if !s.findInvoice(data.OriginalNo) {
+		http.Error(w, fmt.Sprintf("original invoice %q not found", data.OriginalNo), http.StatusBadRequest)
+		return
+	}
+
+	if data.Reason == "" {
+		http.Error(w, "correction reason is required", http.StatusBadRequest)
+		return
+	}
+
+	s.creditNotes = append(s.creditNotes, data)
+
+	writeJson(w, struct {
+		CustomerId string `json:"CustomerId"`
+		InvoiceNo  string `json:"InvoiceNo"`
+	}{data.Customer.Id, data.No})
+}
+
+func (s *Server) findInvoice(no string) bool {
+	for _, data := range s.invoices {
+		if data.No == no {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getInvoices(w http.ResponseWriter, body []byte) {
+	var query struct {
+		PeriodStart string
+		PeriodEnd   string
+	}
+	if err := json.Unmarshal(body, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	periodStart, err := time.Parse("20060102", query.PeriodStart)
+	if err != nil {
+		http.Error(w, "bad PeriodStart", http.StatusBadRequest)
+		return
+	}
+
+	periodEnd, err := time.Parse("20060102", query.PeriodEnd)
+	if err != nil {
+		http.Error(w, "bad PeriodEnd", http.StatusBadRequest)
+		return
+	}
+
+	if periodEnd.Before(periodStart) || periodEnd.After(periodStart.AddDate(0, 3, 0)) {
+		http.Error(w, "period can't be longer than 3 months", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := make([]invoice.Summary, 0)
+	for i, data := range s.invoices {
+		if len(data.DocDate) < 8 {
+			continue
+		}
+		if date := data.DocDate[:8]; date >= query.PeriodStart && date <= query.PeriodEnd {
+			found = append(found, invoice.Summary{Id: fmt.Sprintf("invoice-%d", i+1), No: data.No, DocDate: data.DocDate})
+		}
+	}
+
+	writeJson(w, found)
+}
+
+func (s *Server) getTaxes(w http.ResponseWriter, body []byte) {
+	writeJson(w, []tax.Tax{
+		{Id: "tax-23", Code: "23%", Name: "VAT 23%", Pct: 23},
+		{Id: "tax-8", Code: "8%", Name: "VAT 8%", Pct: 8},
+		{Id: "tax-5", Code: "5%", Name: "VAT 5%", Pct: 5},
+		{Id: "tax-0", Code: "0%", Name: "VAT 0%", Pct: 0},
+		{Id: "tax-zw", Code: "zw", Name: "zwolniony", Pct: 0},
+	})
+}
+
+func writeJson(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,8 @@
+package tax
+
+type Tax struct {
+	Id   string  `json:"Id"`
+	Code string  `json:"Code"`
+	Name string  `json:"Name"`
+	Pct  float64 `json:"TaxPct"`
+}
@@ -1,7 +1,41 @@
 package main
 
 const (
-	textSelectedCsvFile = "Вибраний рапорт TKL: "
-	textChooseCsvFile   = "Вибрати рапорт TKL: "
-	textRun             = "Запустити"
+	textSelectedCsvFile     = "Вибраний рапорт TKL: "
+	textChooseCsvFile       = "Вибрати рапорт TKL: "
+	textSelectedMappingFile = "Вибране зіставлення колонок: "
+	textChooseMappingFile   = "Вибрати зіставлення колонок"
+	textDefaultMapping      = "стандартне"
+	textRun                 = "Запустити"
+	textCancel              = "Скасувати"
+	textChooseProfile       = "Вибрати профіль"
+	textSaveProfile         = "Зберегти профіль"
+	textDeleteProfile       = "Видалити профіль"
+	textProfileName         = "Назва профілю"
+	textDefaultTaxId        = "Стандартна ставка ПДВ (tax id)"
+	textDefaultCustomerId   = "Стандартний клієнт (customer id)"
+	textDefaultPaymentDays  = "Стандартний термін оплати в днях (payment days)"
+	textForgetCredentials   = "Забути облікові дані"
+	textInvalidCredentials  = "Невірний API ID або API Key"
+	textValidationTitle     = "Помилки в рапорті"
+	textValidationProblems  = "Знайдено помилок: %d. Виправте рапорт або завантажте тільки правильні рахунки."
+	textUploadValid         = "Завантажити правильні"
+	textPurchaseMode        = "Рахунки закупівлі від постачальників (vendor)"
+	textGroupAll            = "Об'єднати всі рядки з однаковим номером рахунку"
+	textGrossAmounts        = "Суми брутто (колонка gross)"
+	textDateFormats         = "Формати дат через кому (стандартно: %v)"
+	textPeriodFrom          = "Рахунки з дня (yyyy-MM-dd)"
+	textPeriodTo            = "Рахунки по день (yyyy-MM-dd)"
+	textMonth               = "Обліковий місяць (yyyy-MM)"
+	textMonthBlock          = "Блокувати рахунки поза обліковим місяцем"
+	textOutOfMonthTitle     = "Рахунки поза обліковим місяцем"
+	textOutOfMonth          = "Рахунків поза місяцем %v: %d на суму брутто %v:\n%v\nЗавантажити все одно?"
+	textOutOfMonthBlocked   = "Рахунків поза місяцем %v: %d на суму брутто %v, завантаження заблоковано"
+	textDryRun              = "Пробний запуск (нічого не надсилати)"
+	textDryRunLookups       = "Шукати клієнтів у Księgowość360"
+	textDryRunFinished      = "Заплановані дії збережено у %v"
+	textWorkers             = "Паралельних завантажень: "
+	textFinished            = "Готово"
+	textSummary             = "Оброблено рахунків: %d, пропущено: %d, дублікатів: %d, завершено в попередньому запуску: %d"
+	textCancelled           = "Скасовано"
 )
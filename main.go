@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"mrsydar/tkl/credentials"
 	"mrsydar/tkl/k360/client"
 	"mrsydar/tkl/process"
+	"mrsydar/tkl/profile"
 	"os"
+	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -14,8 +21,14 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
+const (
+	preferenceApiId   = "apiId"
+	preferenceProfile = "profile"
+)
+
 func main() {
-	window := app.New().NewWindow("tkl")
+	application := app.NewWithID("mrsydar.tkl")
+	window := application.NewWindow("tkl")
 
 	var csvPath string
 
@@ -32,33 +45,356 @@ func main() {
 		window,
 	)
 
+	var columnMapping process.ColumnMapping
+
+	mappingFilePathLabel := widget.NewLabel(textSelectedMappingFile + textDefaultMapping)
+	mappingFileDialog := dialog.NewFileOpen(
+		func(uri fyne.URIReadCloser, err error) {
+			if err != nil {
+				log.Println("Error: ", err)
+			} else if uri != nil {
+				mapping, err := process.LoadColumnMapping(uri.URI().Path())
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				columnMapping = mapping
+				mappingFilePathLabel.SetText(textSelectedMappingFile + uri.URI().Path())
+			}
+		},
+		window,
+	)
+
 	apiIdInput := widget.NewEntry()
 	apiIdInput.SetPlaceHolder("API ID")
 
-	apiKeyInput := widget.NewEntry()
+	apiKeyInput := widget.NewPasswordEntry()
 	apiKeyInput.SetPlaceHolder("API Key")
 
+	credentialsDir, err := credentials.DefaultDir()
+	if err != nil {
+		credentialsDir = "."
+	}
+	credentialsStore := credentials.New(credentialsDir)
+
+	forgetCredentialsButton := widget.NewButton(textForgetCredentials, func() {
+		if err := credentialsStore.Delete(apiIdInput.Text); err != nil {
+			dialog.ShowError(err, window)
+		}
+		application.Preferences().RemoveValue(preferenceApiId)
+		apiIdInput.SetText("")
+		apiKeyInput.SetText("")
+	})
+
+	defaultTaxIdInput := widget.NewEntry()
+	defaultTaxIdInput.SetPlaceHolder(textDefaultTaxId)
+
+	defaultCustomerIdInput := widget.NewEntry()
+	defaultCustomerIdInput.SetPlaceHolder(textDefaultCustomerId)
+
+	defaultPaymentDaysInput := widget.NewEntry()
+	defaultPaymentDaysInput.SetPlaceHolder(textDefaultPaymentDays)
+
+	profilesPath, err := profile.DefaultPath()
+	if err != nil {
+		profilesPath = "profiles.json"
+	}
+
+	profiles, err := profile.Load(profilesPath)
+	if err != nil {
+		log.Println("failed to load profiles:", err)
+		profiles = profile.Profiles{}
+	}
+
+	profileSelect := widget.NewSelect(profiles.Names(), func(name string) {
+		selected, err := profiles.Get(name)
+		if err != nil {
+			return
+		}
+
+		application.Preferences().SetString(preferenceProfile, name)
+		apiIdInput.SetText(selected.ApiId)
+		apiKey, _ := credentialsStore.Get(selected.ApiId)
+		apiKeyInput.SetText(apiKey)
+		defaultTaxIdInput.SetText(selected.DefaultTaxId)
+		defaultCustomerIdInput.SetText(selected.DefaultCustomerId)
+		defaultPaymentDaysInput.SetText("")
+		if selected.DefaultPaymentDays != 0 {
+			defaultPaymentDaysInput.SetText(strconv.Itoa(selected.DefaultPaymentDays))
+		}
+	})
+	profileSelect.PlaceHolder = textChooseProfile
+
+	saveProfileButton := widget.NewButton(textSaveProfile, func() {
+		nameDialog := dialog.NewEntryDialog(textSaveProfile, textProfileName, func(name string) {
+			if name == "" {
+				return
+			}
+
+			paymentDays, err := process.ParsePaymentDays(defaultPaymentDaysInput.Text)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+
+			profiles = profiles.Set(profile.Profile{
+				Name:               name,
+				ApiId:              apiIdInput.Text,
+				DefaultTaxId:       defaultTaxIdInput.Text,
+				DefaultCustomerId:  defaultCustomerIdInput.Text,
+				DefaultPaymentDays: paymentDays,
+			})
+			if err := profiles.Save(profilesPath); err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+
+			if apiKeyInput.Text != "" {
+				if err := credentialsStore.Set(apiIdInput.Text, apiKeyInput.Text); err != nil {
+					log.Println("failed to save credentials:", err)
+				}
+			}
+
+			profileSelect.Options = profiles.Names()
+			profileSelect.SetSelected(name)
+		}, window)
+		nameDialog.SetText(profileSelect.Selected)
+		nameDialog.Show()
+	})
+
+	deleteProfileButton := widget.NewButton(textDeleteProfile, func() {
+		if profileSelect.Selected == "" {
+			return
+		}
+
+		profiles = profiles.Delete(profileSelect.Selected)
+		if err := profiles.Save(profilesPath); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		application.Preferences().RemoveValue(preferenceProfile)
+		profileSelect.Options = profiles.Names()
+		profileSelect.ClearSelected()
+	})
+
 	csvFileChooseButton := widget.NewButton(textChooseCsvFile, func() {
 		csvFileDialog.Show()
 	})
 
+	mappingFileChooseButton := widget.NewButton(textChooseMappingFile, func() {
+		mappingFileDialog.Show()
+	})
+
+	groupAllCheck := widget.NewCheck(textGroupAll, nil)
+
+	periodFromInput := widget.NewEntry()
+	periodFromInput.SetPlaceHolder(textPeriodFrom)
+	periodToInput := widget.NewEntry()
+	periodToInput.SetPlaceHolder(textPeriodTo)
+
+	monthInput := widget.NewEntry()
+	monthInput.SetPlaceHolder(textMonth)
+	monthBlockCheck := widget.NewCheck(textMonthBlock, nil)
+
+	dateFormatsInput := widget.NewEntry()
+	dateFormatsInput.SetPlaceHolder(fmt.Sprintf(textDateFormats, strings.Join(process.DefaultDateFormats, ", ")))
+	grossAmountsCheck := widget.NewCheck(textGrossAmounts, nil)
+	purchaseModeCheck := widget.NewCheck(textPurchaseMode, nil)
+
+	dryRunLookupsCheck := widget.NewCheck(textDryRunLookups, nil)
+	dryRunLookupsCheck.SetChecked(true)
+	dryRunLookupsCheck.Disable()
+
+	dryRunCheck := widget.NewCheck(textDryRun, func(checked bool) {
+		if checked {
+			dryRunLookupsCheck.Enable()
+		} else {
+			dryRunLookupsCheck.Disable()
+		}
+	})
+
+	workersSelect := widget.NewSelect([]string{"1", "2", "4", "8"}, nil)
+	workersSelect.SetSelected(strconv.Itoa(process.DefaultWorkers))
+
 	progressBar := NewProgressBarWithMessage()
 
+	var cancelRun context.CancelFunc
+
+	cancelButton := widget.NewButton(textCancel, func() {
+		if cancelRun != nil {
+			cancelRun()
+		}
+	})
+	cancelButton.Disable()
+
 	runButton := widget.NewButton(textRun, nil)
-	runButton.OnTapped = func() {
-		k360Client := client.New(apiIdInput.Text, apiKeyInput.Text)
+
+	startProcessing := func(ctx context.Context, cancel context.CancelFunc, k360Client *client.K360Client, options process.Options) {
 		go func() {
-			disableAll(csvFileChooseButton, runButton, apiIdInput, apiKeyInput)
+			defer cancel()
+
+			disableAll(csvFileChooseButton, mappingFileChooseButton, groupAllCheck, grossAmountsCheck, purchaseModeCheck, dateFormatsInput, periodFromInput, periodToInput, monthInput, monthBlockCheck, dryRunCheck, dryRunLookupsCheck, workersSelect, runButton, apiIdInput, apiKeyInput, forgetCredentialsButton, profileSelect, saveProfileButton, deleteProfileButton, defaultTaxIdInput, defaultCustomerIdInput, defaultPaymentDaysInput)
+			enableAll(cancelButton)
 
-			process.ProcessInvoices(
+			summary, err := process.ProcessInvoices(
+				ctx,
 				*k360Client,
 				csvPath,
+				options,
 				func(message string, recordsNumber, currentRecord int) {
 					progressBar.Update(message, float64(currentRecord)/float64(recordsNumber))
 				},
 			)
+			if errors.Is(err, context.Canceled) {
+				progressBar.Update(textCancelled, progressBar.Value)
+			} else if err != nil {
+				dialog.ShowError(err, window)
+			} else {
+				message := fmt.Sprintf(textSummary, summary.Records, summary.Skipped, summary.Duplicates, summary.Resumed)
+				if options.DryRun {
+					message += "\n" + fmt.Sprintf(textDryRunFinished, process.DryRunReportPath)
+				}
+				dialog.ShowInformation(textFinished, message, window)
+			}
 
-			enableAll(csvFileChooseButton, runButton, apiIdInput, apiKeyInput)
+			disableAll(cancelButton)
+			enableAll(csvFileChooseButton, mappingFileChooseButton, groupAllCheck, grossAmountsCheck, purchaseModeCheck, dateFormatsInput, periodFromInput, periodToInput, monthInput, monthBlockCheck, dryRunCheck, workersSelect, runButton, apiIdInput, apiKeyInput, forgetCredentialsButton, profileSelect, saveProfileButton, deleteProfileButton, defaultTaxIdInput, defaultCustomerIdInput, defaultPaymentDaysInput)
+			if dryRunCheck.Checked {
+				enableAll(dryRunLookupsCheck)
+			}
+		}()
+	}
+
+	runButton.OnTapped = func() {
+		workers, _ := strconv.Atoi(workersSelect.Selected)
+
+		grouping := process.GroupConsecutive
+		if groupAllCheck.Checked {
+			grouping = process.GroupAll
+		}
+
+		amounts := process.AmountsNet
+		if grossAmountsCheck.Checked {
+			amounts = process.AmountsGross
+		}
+
+		mode := process.ModeSales
+		if purchaseModeCheck.Checked {
+			mode = process.ModePurchase
+		}
+
+		dateFormats, err := process.ParseDateFormats(dateFormatsInput.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		period, err := process.ParsePeriod(strings.TrimSpace(periodFromInput.Text), strings.TrimSpace(periodToInput.Text))
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		month, err := process.ParseMonth(strings.TrimSpace(monthInput.Text))
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		paymentDays, err := process.ParsePaymentDays(defaultPaymentDaysInput.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		monthCheck := process.MonthWarn
+		if monthBlockCheck.Checked {
+			monthCheck = process.MonthBlock
+		}
+
+		options := process.Options{
+			Columns:       columnMapping,
+			Mode:          mode,
+			Grouping:      grouping,
+			Amounts:       amounts,
+			TaxTolerance:  process.DefaultTaxTolerance,
+			DryRun:        dryRunCheck.Checked,
+			DryRunLookups: dryRunLookupsCheck.Checked,
+			Workers:       workers,
+			DateFormats:   dateFormats,
+			Period:        period,
+			Month:         month,
+			MonthCheck:    monthCheck,
+
+			DefaultTaxId:      defaultTaxIdInput.Text,
+			DefaultCustomerId: defaultCustomerIdInput.Text,
+
+			DefaultPaymentDays: paymentDays,
+		}
+
+		apiId, apiKey := apiIdInput.Text, apiKeyInput.Text
+		k360Client := client.New(apiId, apiKey)
+
+		// Run stays disabled until the processing starts or the run is
+		// abandoned, Cancel stops the credentials check and the processing
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelRun = cancel
+		abandon := func() {
+			cancel()
+			disableAll(cancelButton)
+			enableAll(runButton)
+		}
+
+		disableAll(runButton)
+		enableAll(cancelButton)
+		go func() {
+			if !options.DryRun || options.DryRunLookups {
+				err := k360Client.VerifyCredentials(ctx)
+				if err != nil {
+					abandon()
+					if errors.Is(err, context.Canceled) {
+						progressBar.Update(textCancelled, progressBar.Value)
+						return
+					}
+					if errors.Is(err, client.ErrInvalidCredentials) {
+						err = errors.New(textInvalidCredentials)
+					}
+					dialog.ShowError(err, window)
+					return
+				}
+
+				application.Preferences().SetString(preferenceApiId, apiId)
+				if err := credentialsStore.Set(apiId, apiKey); err != nil {
+					log.Println("failed to save credentials:", err)
+				}
+			}
+
+			// the dialogs below have their own cancel buttons
+			disableAll(cancelButton)
+
+			problems, err := process.ValidateReport(csvPath, options)
+			if err != nil {
+				abandon()
+				dialog.ShowError(err, window)
+				return
+			}
+
+			start := func(options process.Options) {
+				checkMonth(csvPath, options, window, func() {
+					startProcessing(ctx, cancel, k360Client, options)
+				}, abandon)
+			}
+
+			if len(problems) == 0 {
+				start(options)
+				return
+			}
+
+			showValidationProblems(problems, window, func() {
+				options.IgnoreValidationErrors = true
+				start(options)
+			}, abandon)
 		}()
 	}
 
@@ -70,13 +406,39 @@ func main() {
 
 	log.SetOutput(logFile)
 
+	if name := application.Preferences().String(preferenceProfile); name != "" {
+		profileSelect.SetSelected(name)
+	} else if apiId := application.Preferences().String(preferenceApiId); apiId != "" {
+		apiIdInput.SetText(apiId)
+		if apiKey, err := credentialsStore.Get(apiId); err == nil {
+			apiKeyInput.SetText(apiKey)
+		}
+	}
+
 	content := container.New(layout.NewVBoxLayout(),
+		container.NewBorder(nil, nil, nil, container.NewHBox(saveProfileButton, deleteProfileButton), profileSelect),
 		apiIdInput,
 		apiKeyInput,
+		forgetCredentialsButton,
+		defaultTaxIdInput,
+		defaultCustomerIdInput,
+		defaultPaymentDaysInput,
 		csvFilePathLabel,
 		csvFileChooseButton,
+		mappingFilePathLabel,
+		mappingFileChooseButton,
+		groupAllCheck,
+		grossAmountsCheck,
+		purchaseModeCheck,
+		dateFormatsInput,
+		container.NewGridWithColumns(2, periodFromInput, periodToInput),
+		container.NewBorder(nil, nil, nil, monthBlockCheck, monthInput),
+		dryRunCheck,
+		dryRunLookupsCheck,
+		container.NewHBox(widget.NewLabel(textWorkers), workersSelect),
 		progressBar,
 		runButton,
+		cancelButton,
 	)
 
 	window.SetContent(content)
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"mrsydar/tkl/process"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+func checkMonth(csvPath string, options process.Options, window fyne.Window, onConfirm, onCancel func()) {
+	outOfMonth, err := process.CheckMonth(csvPath, options)
+	if err != nil {
+		dialog.ShowError(err, window)
+		onCancel()
+		return
+	}
+
+	if len(outOfMonth.Invoices) == 0 {
+		onConfirm()
+		return
+	}
+
+	month := outOfMonth.Month.Format("2006-01")
+	if options.MonthCheck == process.MonthBlock {
+		dialog.ShowError(fmt.Errorf(textOutOfMonthBlocked, month, len(outOfMonth.Invoices), outOfMonth.Gross), window)
+		onCancel()
+		return
+	}
+
+	message := fmt.Sprintf(textOutOfMonth, month, len(outOfMonth.Invoices), outOfMonth.Gross, strings.Join(outOfMonth.Invoices, ", "))
+	dialog.ShowConfirm(textOutOfMonthTitle, message, func(confirmed bool) {
+		if confirmed {
+			onConfirm()
+		} else {
+			onCancel()
+		}
+	}, window)
+}
@@ -0,0 +1,75 @@
+package nbp
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+// FileProvider returns rates from a CSV file with currency, date
+// (yyyy-MM-dd) and mid columns, for working offline. An optional fourth
+// column is the table number.
+type FileProvider struct {
+	rates map[string][]Rate
+}
+
+func LoadFile(path string) (*FileProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("can't read rates file %v: %v", path, err)
+	}
+
+	provider := &FileProvider{rates: make(map[string][]Rate)}
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "currency") {
+			continue
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("rates file %v, line %v: expected currency, date and mid", path, i+1)
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(record[0]))
+		date, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(record[1]), warsaw)
+		if err != nil {
+			return nil, fmt.Errorf("rates file %v, line %v: %q is not a date in yyyy-MM-dd format", path, i+1, record[1])
+		}
+		mid, err := invoice.ParseAmount(record[2])
+		if err != nil || mid.Sign() <= 0 {
+			return nil, fmt.Errorf("rates file %v, line %v: %q is not a rate", path, i+1, record[2])
+		}
+
+		rate := Rate{Currency: currency, Date: date, Mid: mid}
+		if len(record) > 3 {
+			rate.Table = strings.TrimSpace(record[3])
+		}
+		provider.rates[currency] = append(provider.rates[currency], rate)
+	}
+
+	for _, rates := range provider.rates {
+		sort.Slice(rates, func(i, j int) bool {
+			return rates[i].Date.Before(rates[j].Date)
+		})
+	}
+
+	return provider, nil
+}
+
+func (p *FileProvider) MidRate(ctx context.Context, currency string, date time.Time) (Rate, error) {
+	currency = strings.ToUpper(currency)
+	return lastBefore(p.rates[currency], currency, startOfDay(date))
+}
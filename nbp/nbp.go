@@ -0,0 +1,148 @@
+package nbp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+var BaseURL = "https://api.nbp.pl"
+
+// lookback is how far before the transaction date a rate is searched for,
+// long enough for any holidays.
+const lookback = 14
+
+var ErrNotFound = errors.New("exchange rate not found")
+
+var warsaw, _ = time.LoadLocation("Europe/Warsaw")
+
+// Rate is a mid rate of a currency in PLN from the NBP table A.
+type Rate struct {
+	Currency string
+	Table    string
+	Date     time.Time
+	Mid      invoice.Decimal
+}
+
+// Provider returns the mid rate of the currency from the last business day
+// before the date, as required for VAT.
+type Provider interface {
+	MidRate(ctx context.Context, currency string, date time.Time) (Rate, error)
+}
+
+// Client gets rates from the NBP web API, every rate is requested once.
+type Client struct {
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]Rate
+}
+
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		cache:      make(map[string]Rate),
+	}
+}
+
+func (c *Client) MidRate(ctx context.Context, currency string, date time.Time) (Rate, error) {
+	currency = strings.ToUpper(currency)
+	day := startOfDay(date)
+	key := currency + day.Format("2006-01-02")
+
+	c.mu.Lock()
+	rate, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return rate, nil
+	}
+
+	rates, err := c.getRates(ctx, currency, day.AddDate(0, 0, -lookback), day.AddDate(0, 0, -1))
+	if err != nil {
+		return Rate{}, err
+	}
+
+	rate, err = lastBefore(rates, currency, day)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	c.mu.Lock()
+	c.cache[key] = rate
+	c.mu.Unlock()
+
+	return rate, nil
+}
+
+func (c *Client) getRates(ctx context.Context, currency string, from, to time.Time) ([]Rate, error) {
+	url := fmt.Sprintf("%s/api/exchangerates/rates/a/%s/%s/%s/?format=json", BaseURL, strings.ToLower(currency), from.Format("2006-01-02"), to.Format("2006-01-02"))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: no NBP rates of %v between %v and %v", ErrNotFound, currency, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("bad response with code %v: %v", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var table struct {
+		Table string `json:"table"`
+		Code  string `json:"code"`
+		Rates []struct {
+			No            string          `json:"no"`
+			EffectiveDate string          `json:"effectiveDate"`
+			Mid           invoice.Decimal `json:"mid"`
+		} `json:"rates"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&table); err != nil {
+		return nil, fmt.Errorf("can't decode response body: %v", err)
+	}
+
+	rates := make([]Rate, 0, len(table.Rates))
+	for _, rate := range table.Rates {
+		date, err := time.ParseInLocation("2006-01-02", rate.EffectiveDate, warsaw)
+		if err != nil {
+			return nil, fmt.Errorf("bad effective date %q", rate.EffectiveDate)
+		}
+		rates = append(rates, Rate{Currency: currency, Table: rate.No, Date: date, Mid: rate.Mid})
+	}
+	return rates, nil
+}
+
+// lastBefore returns the latest of rates sorted by date which is before
+// the day but not more than lookback days.
+func lastBefore(rates []Rate, currency string, day time.Time) (Rate, error) {
+	earliest := day.AddDate(0, 0, -lookback)
+	for i := len(rates) - 1; i >= 0; i-- {
+		if rates[i].Date.Before(day) && !rates[i].Date.Before(earliest) {
+			return rates[i], nil
+		}
+	}
+	return Rate{}, fmt.Errorf("%w: no NBP rate of %v in %v days before %v", ErrNotFound, currency, lookback, day.Format("2006-01-02"))
+}
+
+func startOfDay(date time.Time) time.Time {
+	date = date.In(warsaw)
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, warsaw)
+}
@@ -0,0 +1,100 @@
+package nbp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupServer(t *testing.T) *int {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/api/exchangerates/rates/a/eur/2022-05-17/2022-05-30/":
+			fmt.Fprint(w, `{"table":"A","currency":"euro","code":"EUR","rates":[`+
+				`{"no":"101/A/NBP/2022","effectiveDate":"2022-05-26","mid":4.5823},`+
+				`{"no":"102/A/NBP/2022","effectiveDate":"2022-05-27","mid":4.5785},`+
+				`{"no":"103/A/NBP/2022","effectiveDate":"2022-05-30","mid":4.5654}]}`)
+		default:
+			http.Error(w, "404 NotFound - Not Found - Brak danych", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previousURL := BaseURL
+	BaseURL = server.URL
+	t.Cleanup(func() { BaseURL = previousURL })
+
+	return &requests
+}
+
+func TestClientMidRate(t *testing.T) {
+	requests := setupServer(t)
+	client := NewClient()
+
+	for i := 0; i < 2; i++ {
+		rate, err := client.MidRate(context.Background(), "eur", time.Date(2022, 5, 31, 12, 0, 0, 0, warsaw))
+		if err != nil {
+			t.Fatalf("error was not expected: %v", err)
+		}
+
+		if rate.Currency != "EUR" || rate.Table != "103/A/NBP/2022" || rate.Mid.String() != "4.5654" {
+			t.Fatalf("unexpected rate: %+v", rate)
+		}
+	}
+
+	if *requests != 1 {
+		t.Fatalf("the rate should be requested once, but was requested %v times", *requests)
+	}
+
+	if _, err := client.MidRate(context.Background(), "XYZ", time.Date(2022, 5, 31, 0, 0, 0, 0, warsaw)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, but got %v", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	content := "currency,date,mid\nEUR,2022-05-30,4.5654\nEUR,2022-05-27,\"4,5785\"\nUSD,2022-05-27,4.2654\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	tests := []struct {
+		currency string
+		date     time.Time
+		expected string
+	}{
+		// Monday uses the rate from Friday
+		{"EUR", time.Date(2022, 5, 30, 23, 0, 0, 0, warsaw), "4.5785"},
+		{"eur", time.Date(2022, 5, 31, 0, 0, 0, 0, warsaw), "4.5654"},
+		{"USD", time.Date(2022, 6, 1, 0, 0, 0, 0, warsaw), "4.2654"},
+		{"USD", time.Date(2022, 6, 30, 0, 0, 0, 0, warsaw), ""},
+		{"EUR", time.Date(2022, 5, 27, 0, 0, 0, 0, warsaw), ""},
+		{"GBP", time.Date(2022, 5, 31, 0, 0, 0, 0, warsaw), ""},
+	}
+
+	for _, test := range tests {
+		rate, err := provider.MidRate(context.Background(), test.currency, test.date)
+		if test.expected == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%v at %v: expected ErrNotFound, but got %v", test.currency, test.date, err)
+			}
+			continue
+		}
+		if err != nil || rate.Mid.String() != test.expected {
+			t.Errorf("%v at %v: expected %v, but got %v, %v", test.currency, test.date, test.expected, rate.Mid, err)
+		}
+	}
+}
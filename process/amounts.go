@@ -0,0 +1,91 @@
+package process
+
+import (
+	"fmt"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+// Amounts decides which amounts of a record are given in the report, the
+// others are derived from them.
+type Amounts int
+
+const (
+	// AmountsNet takes the net value and tax of every record, as in
+	// invoices.
+	AmountsNet Amounts = iota
+	// AmountsGross takes the gross value of every record and calculates the
+	// tax from its VAT rate, as in receipts.
+	AmountsGross
+)
+
+func ParseAmounts(value string) (Amounts, error) {
+	switch value {
+	case "", "net":
+		return AmountsNet, nil
+	case "gross":
+		return AmountsGross, nil
+	}
+	return AmountsNet, fmt.Errorf("unknown amounts %q, expected net or gross", value)
+}
+
+// invoiceLines derives the amounts of every record of an invoice. With
+// AmountsGross the VAT rate of every record must be known.
+func invoiceLines(records []Record, amounts Amounts, rates taxRates) ([]invoice.Line, error) {
+	lines := make([]invoice.Line, 0, len(records))
+	for _, record := range records {
+		quantity := invoice.NewDecimal(1)
+		if record.Quantity != "" {
+			parsed, err := invoice.ParseAmount(record.Quantity)
+			if err != nil {
+				return nil, fmt.Errorf("bad quantity: %v", err)
+			}
+			quantity = parsed
+		}
+
+		var line invoice.Line
+		var err error
+		if amounts == AmountsGross {
+			line, err = grossLine(record, quantity, rates)
+		} else {
+			line, err = netLine(record, quantity)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", record.Line, err)
+		}
+
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func netLine(record Record, quantity invoice.Decimal) (invoice.Line, error) {
+	net, err := invoice.ParseAmount(record.Net)
+	if err != nil {
+		return invoice.Line{}, fmt.Errorf("bad net value: %v", err)
+	}
+
+	tax, err := invoice.ParseAmount(record.Tax)
+	if err != nil {
+		return invoice.Line{}, fmt.Errorf("bad tax: %v", err)
+	}
+
+	return invoice.LineFromNet(net, tax, quantity)
+}
+
+func grossLine(record Record, quantity invoice.Decimal, rates taxRates) (invoice.Line, error) {
+	gross, err := invoice.ParseAmount(record.Gross)
+	if err != nil {
+		return invoice.Line{}, fmt.Errorf("bad gross value: %v", err)
+	}
+
+	rate, ok, err := rates.vatRate(record)
+	if err != nil {
+		return invoice.Line{}, err
+	}
+	if !ok {
+		return invoice.Line{}, fmt.Errorf("VAT rate of tax id %q is unknown, add the %v column", record.TaxId, ColumnVatRate)
+	}
+
+	return invoice.LineFromGross(gross, rate, quantity)
+}
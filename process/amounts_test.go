@@ -0,0 +1,94 @@
+package process
+
+import (
+	"context"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+func TestProcessInvoicesGrossAmounts(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t, "no,date,customer_nip,gross,tax_id,customer_id,product_code,product_description,quantity,vat_rate",
+		"PAR/1,20220531120000,,123.00,tax-23,"+walkInId+",P1,Product 1,2,",
+		"PAR/1,20220531120000,,10.00,tax-8,"+walkInId+",P2,Product 2,,",
+		"PAR/2,20220531130000,,10.50,tax-7,"+walkInId+",P3,Product 3,,5%",
+		"PAR/3,20220531140000,,10.00,tax-7,"+walkInId+",P4,Product 4,,",
+	)
+
+	options := Options{Amounts: AmountsGross}
+	if problems, err := ValidateReport(report, options); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][0] != "PAR/3" || skipped[0][10] != string(StageTaxCheck) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 2 {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	first := invoices[0]
+	if first.TotalAmount.String() != "133.00" || first.TaxAmounts[0].Amount.String() != "23.00" || first.TaxAmounts[1].Amount.String() != "0.74" {
+		t.Fatalf("unexpected first invoice: %+v", first)
+	}
+	if first.Rows[0].Quantity.String() != "2.00" || first.Rows[0].Price.String() != "50.00" || first.Rows[1].Price.String() != "9.26" {
+		t.Fatalf("unexpected rows: %+v", first.Rows)
+	}
+
+	if second := invoices[1]; second.TotalAmount.String() != "10.50" || second.TaxAmounts[0].Amount.String() != "0.50" {
+		t.Fatalf("unexpected second invoice: %+v", second)
+	}
+}
+
+func TestGrossReportRequiresGrossColumn(t *testing.T) {
+	report := writeReport(t, "FV/1,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1")
+
+	if _, err := ValidateReport(report, Options{Amounts: AmountsGross}); err == nil {
+		t.Fatalf("error was expected")
+	}
+}
+
+func TestProcessInvoicesPolishAmounts(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t, testHeader+",quantity",
+		`FV/1,20220531120000,,"1 234,50","283,94",tax-23,`+walkInId+`,P1,Product 1,"1,5"`,
+		`FV/2,20220531130000,,"1,234.50",283.935,tax-23,`+walkInId+`,P2,Product 2,`,
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Column != ColumnTax {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{IgnoreValidationErrors: true}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 1 || invoices[0].TotalAmount.String() != "1518.44" || invoices[0].TaxAmounts[0].Amount.String() != "283.94" || invoices[0].Rows[0].Price.String() != "823.00" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
@@ -0,0 +1,265 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	ColumnNo                 = "no"
+	ColumnDate               = "date"
+	ColumnCustomerNip        = "customer_nip"
+	ColumnNet                = "net"
+	ColumnTax                = "tax"
+	ColumnTaxId              = "tax_id"
+	ColumnCustomerId         = "customer_id"
+	ColumnProductCode        = "product_code"
+	ColumnProductDescription = "product_description"
+	ColumnQuantity           = "quantity"
+	ColumnVatRate            = "vat_rate"
+	ColumnGross              = "gross"
+	ColumnCurrency           = "currency"
+	ColumnDocType            = "doc_type"
+	ColumnOriginalNo         = "original_no"
+	ColumnOriginalDate       = "original_date"
+	ColumnCorrectionReason   = "correction_reason"
+	ColumnDueDate            = "due_date"
+	ColumnTransactionDate    = "transaction_date"
+	ColumnPaymentDays        = "payment_days"
+)
+
+var requiredColumns = []string{
+	ColumnNo,
+	ColumnDate,
+	ColumnCustomerNip,
+	ColumnNet,
+	ColumnTax,
+	ColumnTaxId,
+	ColumnCustomerId,
+	ColumnProductCode,
+	ColumnProductDescription,
+}
+
+var optionalColumns = []string{
+	ColumnQuantity,
+	ColumnVatRate,
+	ColumnGross,
+	ColumnCurrency,
+	ColumnDocType,
+	ColumnOriginalNo,
+	ColumnOriginalDate,
+	ColumnCorrectionReason,
+	ColumnDueDate,
+	ColumnTransactionDate,
+	ColumnPaymentDays,
+}
+
+// columnsOf returns the required and optional columns of a report with the
+// given amounts.
+func columnsOf(amounts Amounts) (required, optional []string) {
+	if amounts != AmountsGross {
+		return requiredColumns, optionalColumns
+	}
+
+	for _, column := range requiredColumns {
+		if column != ColumnNet && column != ColumnTax {
+			required = append(required, column)
+		}
+	}
+	required = append(required, ColumnGross)
+
+	for _, column := range optionalColumns {
+		if column != ColumnGross {
+			optional = append(optional, column)
+		}
+	}
+	optional = append(optional, ColumnNet, ColumnTax)
+
+	return required, optional
+}
+
+// ColumnMapping maps column names documented in the README to the header
+// names used by a particular export. Columns which are not mapped are looked
+// up by their documented name.
+type ColumnMapping map[string]string
+
+func LoadColumnMapping(path string) (ColumnMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(ColumnMapping)
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("can't parse column mapping %v: %v", path, err)
+	}
+
+	for column := range mapping {
+		if !isKnownColumn(column) {
+			return nil, fmt.Errorf("unknown column %q in column mapping %v", column, path)
+		}
+	}
+
+	return mapping, nil
+}
+
+func isKnownColumn(column string) bool {
+	for _, known := range append(requiredColumns, optionalColumns...) {
+		if known == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (mapping ColumnMapping) headerName(column string) string {
+	if name, ok := mapping[column]; ok {
+		return name
+	}
+	return column
+}
+
+type Record struct {
+	Line int
+	Raw  []string
+
+	No                 string
+	Date               string
+	CustomerNip        string
+	Net                string
+	Tax                string
+	TaxId              string
+	CustomerId         string
+	ProductCode        string
+	ProductDescription string
+	Quantity           string
+	VatRate            string
+	Gross              string
+	Currency           string
+	DocType            string
+	OriginalNo         string
+	OriginalDate       string
+	CorrectionReason   string
+	DueDate            string
+	TransactionDate    string
+	PaymentDays        string
+}
+
+func (record Record) withDefaults(options Options) Record {
+	if strings.TrimSpace(record.TaxId) == "" {
+		record.TaxId = options.DefaultTaxId
+	}
+	if record.CustomerNip == "" && strings.TrimSpace(record.CustomerId) == "" {
+		record.CustomerId = options.DefaultCustomerId
+	}
+	return record
+}
+
+// normalized applies the defaults, converts dates to the format of the
+// Księgowość360 API, the currency to upper case, PLN when it's empty, the
+// document type to one of the DocType constants and sets the due date as
+// described by normalizedPayment. Values which can't be parsed are left as
+// they are.
+func (record Record) normalized(options Options) Record {
+	record = record.withDefaults(options).normalizedPayment(options)
+	record.Currency = strings.ToUpper(strings.TrimSpace(record.Currency))
+	if record.Currency == "" {
+		record.Currency = plnCurrency
+	}
+	if docType, err := parseDocType(record.DocType); err == nil {
+		record.DocType = docType
+	}
+	if date, err := parseReportDate(record.Date, options.DateFormats); err == nil {
+		record.Date = formatApiDate(date)
+	}
+	if date, err := parseReportDate(record.OriginalDate, options.DateFormats); err == nil {
+		record.OriginalDate = formatApiDate(date)
+	}
+	return record
+}
+
+type columnIndex map[string]int
+
+func newColumnIndex(header []string, options Options) (columnIndex, error) {
+	mapping := options.Columns
+	required, optional := columnsOf(options.Amounts)
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[normalizeHeaderName(name)] = i
+	}
+
+	index := make(columnIndex, len(required))
+	missing := make([]string, 0)
+	for _, column := range required {
+		name := mapping.headerName(column)
+		position, ok := positions[normalizeHeaderName(name)]
+		if !ok {
+			if name == column {
+				missing = append(missing, fmt.Sprintf("%q", column))
+			} else {
+				missing = append(missing, fmt.Sprintf("%q (mapped to %q)", column, name))
+			}
+			continue
+		}
+		index[column] = position
+	}
+
+	for _, column := range optional {
+		if position, ok := positions[normalizeHeaderName(mapping.headerName(column))]; ok {
+			index[column] = position
+		}
+	}
+
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("required columns are missing in the report header: %v", strings.Join(missing, ", "))
+	}
+
+	return index, nil
+}
+
+func normalizeHeaderName(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+}
+
+func (index columnIndex) record(raw []string, line int) (Record, error) {
+	for _, column := range requiredColumns {
+		if position, ok := index[column]; ok && position >= len(raw) {
+			return Record{}, fmt.Errorf("line %v: column %q is missing, record has only %v fields", line, column, len(raw))
+		}
+	}
+
+	optional := func(column string) string {
+		if position, ok := index[column]; ok && position < len(raw) {
+			return raw[position]
+		}
+		return ""
+	}
+
+	return Record{
+		Line:               line,
+		Raw:                raw,
+		No:                 raw[index[ColumnNo]],
+		Date:               raw[index[ColumnDate]],
+		CustomerNip:        raw[index[ColumnCustomerNip]],
+		Net:                optional(ColumnNet),
+		Tax:                optional(ColumnTax),
+		TaxId:              raw[index[ColumnTaxId]],
+		CustomerId:         raw[index[ColumnCustomerId]],
+		ProductCode:        raw[index[ColumnProductCode]],
+		ProductDescription: raw[index[ColumnProductDescription]],
+		Quantity:           optional(ColumnQuantity),
+		VatRate:            optional(ColumnVatRate),
+		Gross:              optional(ColumnGross),
+		Currency:           optional(ColumnCurrency),
+		DocType:            optional(ColumnDocType),
+		OriginalNo:         optional(ColumnOriginalNo),
+		OriginalDate:       optional(ColumnOriginalDate),
+		CorrectionReason:   optional(ColumnCorrectionReason),
+		DueDate:            optional(ColumnDueDate),
+		TransactionDate:    optional(ColumnTransactionDate),
+		PaymentDays:        optional(ColumnPaymentDays),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColumnIndexIgnoresCaseAndBom(t *testing.T) {
+	header := []string{"\ufeffNo", " Date ", "CUSTOMER_NIP", "net", "tax", "tax_id", "customer_id", "product_code", "product_description", "extra"}
+
+	index, err := newColumnIndex(header, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	record, err := index.record([]string{"FV/1", "20220531120000", "", "1.00", "0.23", "t", "c", "p", "d", "x"}, 2)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if record.No != "FV/1" || record.Date != "20220531120000" || record.ProductDescription != "d" || record.Line != 2 {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+}
+
+func TestColumnIndexShortRecord(t *testing.T) {
+	index, err := newColumnIndex(requiredColumns, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if _, err := index.record([]string{"FV/1", "20220531120000"}, 3); err == nil {
+		t.Fatalf("error was expected")
+	}
+}
+
+func TestLoadColumnMappingUnknownColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "columns.json")
+	if err := os.WriteFile(path, []byte(`{"number": "Numer"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadColumnMapping(path); err == nil {
+		t.Fatalf("error was expected")
+	}
+}
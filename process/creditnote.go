@@ -0,0 +1,74 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+const (
+	DocInvoice    = "invoice"
+	DocCreditNote = "credit_note"
+)
+
+// parseDocType parses the doc_type column, empty is an invoice and
+// korekta or KOR a credit note.
+func parseDocType(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", DocInvoice, "faktura", "fv":
+		return DocInvoice, nil
+	case DocCreditNote, "korekta", "kor":
+		return DocCreditNote, nil
+	}
+	return "", fmt.Errorf("%q is not a document type, expected %v or %v", value, DocInvoice, DocCreditNote)
+}
+
+// checkCreditNote adds problems of the credit note columns of the record.
+// The original invoice must be issued before the credit note and only
+// credit notes can have negative amounts.
+func checkCreditNote(record Record, options Options, addProblem func(column, format string, args ...interface{})) {
+	docType, err := parseDocType(record.DocType)
+	if err != nil {
+		addProblem(ColumnDocType, "%v", err)
+		return
+	}
+	if docType != DocCreditNote {
+		if options.Amounts == AmountsGross {
+			checkNotNegative(ColumnGross, record.Gross, addProblem)
+		} else {
+			checkNotNegative(ColumnNet, record.Net, addProblem)
+			checkNotNegative(ColumnTax, record.Tax, addProblem)
+		}
+		return
+	}
+
+	if options.Mode == ModePurchase {
+		addProblem(ColumnDocType, "credit notes can't be uploaded as purchase invoices")
+		return
+	}
+
+	if strings.TrimSpace(record.OriginalNo) == "" {
+		addProblem(ColumnOriginalNo, "original invoice number of the credit note is empty")
+	}
+
+	if strings.TrimSpace(record.CorrectionReason) == "" {
+		addProblem(ColumnCorrectionReason, "correction reason of the credit note is empty")
+	}
+
+	originalDate, err := parseReportDate(record.OriginalDate, options.DateFormats)
+	if err != nil {
+		addProblem(ColumnOriginalDate, "%v", err)
+		return
+	}
+
+	if date, err := parseReportDate(record.Date, options.DateFormats); err == nil && originalDate.After(date) {
+		addProblem(ColumnOriginalDate, "original invoice date %v is after the credit note date %v", originalDate.Format("2006-01-02"), date.Format("2006-01-02"))
+	}
+}
+
+func checkNotNegative(column, value string, addProblem func(column, format string, args ...interface{})) {
+	if amount, err := invoice.ParseAmount(value); err == nil && amount.Sign() < 0 {
+		addProblem(column, "%q is negative, only credit notes can have negative amounts", value)
+	}
+}
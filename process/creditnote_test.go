@@ -0,0 +1,155 @@
+package process
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+)
+
+const creditNoteHeader = testHeader + ",doc_type,original_no,original_date,correction_reason"
+
+func TestProcessInvoicesCreditNotes(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	server.AddInvoice(invoice.Invoice{Customer: invoice.Customer{Id: walkInId}, No: "FV/1", DocDate: "20220510120000"})
+
+	report := writeReportWithHeader(t, creditNoteHeader,
+		"KOR/1,20220531120000,,-20.00,-4.60,tax-23,"+walkInId+",P1,Product 1,korekta,FV/1,10.05.2022,price reduction",
+		"KOR/1,20220531120000,,-10.00,-0.80,tax-8,"+walkInId+",P2,Product 2,credit_note,FV/1,2022-05-10,price reduction",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3,,,,",
+		"KOR/2,20220531140000,,-10.00,-0.80,tax-8,"+walkInId+",P4,Product 4,credit_note,FV/9,2022-05-10,returned goods",
+	)
+
+	if problems, err := ValidateReport(report, Options{}); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{TaxTolerance: DefaultTaxTolerance}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][0] != "KOR/2" || skipped[0][13] != string(StageInvoicePost) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 2 || invoices[1].No != "FV/2" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	creditNotes := server.CreditNotes()
+	if len(creditNotes) != 1 {
+		t.Fatalf("unexpected credit notes: %+v", creditNotes)
+	}
+
+	creditNote := creditNotes[0]
+	if creditNote.No != "KOR/1" || creditNote.OriginalNo != "FV/1" || creditNote.OriginalDate != "20220510000000" || creditNote.Reason != "price reduction" {
+		t.Fatalf("unexpected credit note: %+v", creditNote)
+	}
+	if len(creditNote.Rows) != 2 || creditNote.TotalAmount.String() != "-35.40" || creditNote.TaxAmounts[0].Amount.String() != "-4.60" {
+		t.Fatalf("unexpected credit note amounts: %+v", creditNote)
+	}
+}
+
+func TestValidateReportCreditNotes(t *testing.T) {
+	report := writeReportWithHeader(t, creditNoteHeader,
+		"KOR/1,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,credit_note,,2022-05-10,",
+		"KOR/2,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,credit_note,FV/1,2022-06-10,price reduction",
+		"KOR/3,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,receipt,,,",
+		"KOR/4,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,credit_note,FV/1,2022-05-10,price reduction",
+		"KOR/4,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,credit_note,FV/2,2022-05-10,price reduction",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	expected := []struct {
+		line   int
+		column string
+	}{
+		{2, ColumnOriginalNo},
+		{2, ColumnCorrectionReason},
+		{3, ColumnOriginalDate},
+		{4, ColumnDocType},
+		{6, ColumnOriginalNo},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for i, problem := range problems {
+		if problem.Line != expected[i].line || problem.Column != expected[i].column {
+			t.Fatalf("unexpected problems: %v", problems)
+		}
+	}
+}
+
+func TestValidateReportNegativeInvoice(t *testing.T) {
+	report := writeReportWithHeader(t, creditNoteHeader,
+		"FV/1,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,,,,",
+		"FV/2,20220531120000,,-20.00,4.60,tax-23,c,P1,Product 1,invoice,,,",
+		"KOR/1,20220531120000,,-20.00,-4.60,tax-23,c,P1,Product 1,credit_note,FV/1,2022-05-10,price reduction",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	expected := []Problem{
+		{2, ColumnNet, `"-20.00" is negative, only credit notes can have negative amounts`},
+		{2, ColumnTax, `"-4.60" is negative, only credit notes can have negative amounts`},
+		{3, ColumnNet, `"-20.00" is negative, only credit notes can have negative amounts`},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("expected problems %v, but got %v", expected, problems)
+	}
+}
+
+func TestProcessInvoicesCreditNoteBeforeOriginal(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{"5260250995": "SZAMOTULSKA 40/1A, 60-366 POZNAŃ"})
+	knownId := server.AddCustomer(customer.Customer{Name: "KNOWN", Nip: "7792465289"})
+
+	report := writeReportWithHeader(t, creditNoteHeader,
+		"KOR/1,20220531120000,7792465289,-20.00,-4.60,tax-23,,P1,Product 1,credit_note,FV/1,2022-05-10,price reduction",
+		"KOR/2,20220531120000,5260250995,-10.00,-0.80,tax-8,,P2,Product 2,credit_note,FV/2,2022-05-10,returned goods",
+		"FV/1,20220510120000,7792465289,100.00,23.00,tax-23,,P1,Product 1,,,,",
+		"FV/2,20220510120000,5260250995,50.00,4.00,tax-8,,P2,Product 2,,,,",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{TaxTolerance: DefaultTaxTolerance, Workers: 4}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 4 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 2 {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	creditNotes := server.CreditNotes()
+	if len(creditNotes) != 2 {
+		t.Fatalf("unexpected credit notes: %+v", creditNotes)
+	}
+	for _, creditNote := range creditNotes {
+		if creditNote.No == "KOR/1" && creditNote.Customer.Id != knownId {
+			t.Fatalf("unexpected customer of %v: %v", creditNote.No, creditNote.Customer.Id)
+		}
+	}
+
+	if customers := server.Customers(); len(customers) != 2 {
+		t.Fatalf("new customer should be created once: %+v", customers)
+	}
+}
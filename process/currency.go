@@ -0,0 +1,47 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"mrsydar/tkl/nbp"
+)
+
+const plnCurrency = "PLN"
+
+var currencyRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
+func checkCurrency(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value != "" && !currencyRegex.MatchString(value) {
+		return fmt.Sprintf("%q is not a currency code like EUR", value)
+	}
+	return ""
+}
+
+// exchangeRate returns the NBP rate of the invoice currency used for VAT,
+// nil for PLN invoices. The rate is taken for the transaction date, which
+// is the invoice date unless the report sets it.
+func (p *processor) exchangeRate(group *invoiceRecords) (*nbp.Rate, error) {
+	record := group.first()
+	if record.Currency == plnCurrency {
+		return nil, nil
+	}
+
+	transactionDate := record.TransactionDate
+	if transactionDate == "" {
+		transactionDate = record.Date
+	}
+	date, err := time.ParseInLocation(apiDateLayout, transactionDate, warsaw)
+	if err != nil {
+		return nil, fmt.Errorf("bad transaction date %q", transactionDate)
+	}
+
+	rate, err := p.currencyRates.MidRate(p.ctx, record.Currency, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NBP rate of %v for %v: %v", record.Currency, date.Format("2006-01-02"), err)
+	}
+	return &rate, nil
+}
@@ -0,0 +1,138 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/nbp"
+)
+
+// fakeRates returns the rate of the day before the requested date.
+type fakeRates map[string]string
+
+func (rates fakeRates) MidRate(ctx context.Context, currency string, date time.Time) (nbp.Rate, error) {
+	mid, ok := rates[currency]
+	if !ok {
+		return nbp.Rate{}, fmt.Errorf("%w: %v", nbp.ErrNotFound, currency)
+	}
+
+	parsed, err := invoice.ParseDecimal(mid)
+	if err != nil {
+		return nbp.Rate{}, err
+	}
+	return nbp.Rate{Currency: currency, Table: "1/A/NBP/2022", Date: date.AddDate(0, 0, -1), Mid: parsed}, nil
+}
+
+// recordingRates remembers the dates rates were requested for.
+type recordingRates struct {
+	fakeRates
+
+	mu    sync.Mutex
+	dates []string
+}
+
+func (rates *recordingRates) MidRate(ctx context.Context, currency string, date time.Time) (nbp.Rate, error) {
+	rates.mu.Lock()
+	rates.dates = append(rates.dates, date.Format("2006-01-02"))
+	rates.mu.Unlock()
+
+	return rates.fakeRates.MidRate(ctx, currency, date)
+}
+
+func TestProcessInvoicesForeignCurrency(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t, testHeader+",currency",
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1,eur",
+		"FV/1,20220531120000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2,EUR",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3,",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P4,Product 4,GBP",
+		"FV/4,20220531150000,,10.00,0.80,tax-8,"+walkInId+",P5,Product 5,PLN",
+	)
+
+	options := Options{CurrencyRates: fakeRates{"EUR": "4.5654"}}
+	if problems, err := ValidateReport(report, options); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][0] != "FV/3" || skipped[0][10] != string(StageExchangeRate) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 3 {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	first := invoices[0]
+	if first.CurrencyCode != "EUR" || first.CurrencyRate == nil || first.CurrencyRate.String() != "4.5654" {
+		t.Fatalf("unexpected currency of the first invoice: %+v", first)
+	}
+
+	if net, tax := first.AmountsInPLN(); net.String() != "684.81" || tax.String() != "123.27" {
+		t.Fatalf("unexpected amounts in PLN: %v, %v", net, tax)
+	}
+
+	for _, posted := range invoices[1:] {
+		if posted.CurrencyCode != "" || posted.CurrencyRate != nil {
+			t.Fatalf("PLN invoice should not have a currency: %+v", posted)
+		}
+	}
+}
+
+func TestValidateReportCurrency(t *testing.T) {
+	report := writeReportWithHeader(t, testHeader+",currency",
+		"FV/1,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,EUR",
+		"FV/1,20220531120000,,50.00,4.00,tax-8,c,P2,Product 2,USD",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,c,P3,Product 3,euro",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if len(problems) != 2 || problems[0].Line != 3 || problems[1].Line != 4 || problems[0].Column != ColumnCurrency || problems[1].Column != ColumnCurrency {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
+
+func TestProcessInvoicesRateOfTransactionDate(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t, testHeader+",currency,transaction_date",
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1,EUR,2022-05-10",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,"+walkInId+",P2,Product 2,EUR,",
+	)
+
+	rates := &recordingRates{fakeRates: fakeRates{"EUR": "4.5654"}}
+	options := Options{CurrencyRates: rates, Workers: 1}
+	if _, err := ProcessInvoices(context.Background(), k360, report, options, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if expected := []string{"2022-05-10", "2022-05-31"}; !reflect.DeepEqual(rates.dates, expected) {
+		t.Fatalf("expected rates for %v, but got %v", expected, rates.dates)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 2 || invoices[0].TransactionDate != "20220510000000" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
@@ -0,0 +1,197 @@
+package process
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// apiDateLayout is the date format of the Księgowość360 API.
+const apiDateLayout = "20060102150405"
+
+// DefaultDateFormats are the formats of the date column accepted when
+// Options.DateFormats is empty. Excel serial dates like 44712 are always
+// accepted.
+var DefaultDateFormats = []string{
+	"yyyyMMddHHmmss",
+	"yyyyMMdd",
+	"yyyy-MM-dd",
+	"yyyy-MM-dd HH:mm:ss",
+	"yyyy-MM-ddTHH:mm:ss",
+	"dd.MM.yyyy",
+	"dd.MM.yyyy HH:mm:ss",
+}
+
+// excelEpoch is the day 0 of Excel serial dates, it's not 1900-01-01 as
+// Excel treats 1900 as a leap year.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+var warsaw = mustLoadLocation("Europe/Warsaw")
+
+// now is replaced in tests.
+var now = time.Now
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+var dateLayoutReplacer = strings.NewReplacer(
+	"yyyy", "2006",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+	"mm", "04",
+	"ss", "05",
+)
+
+// ParseDateLayout converts a date format like dd.MM.yyyy HH:mm to a Go time
+// layout.
+func ParseDateLayout(format string) (string, error) {
+	format = strings.TrimSpace(format)
+	for _, part := range []string{"yyyy", "MM", "dd"} {
+		if !strings.Contains(format, part) {
+			return "", fmt.Errorf("date format %q has no %v", format, part)
+		}
+	}
+	return dateLayoutReplacer.Replace(format), nil
+}
+
+// ParseDateFormats parses a comma separated list of date formats.
+func ParseDateFormats(list string) ([]string, error) {
+	formats := make([]string, 0)
+	for _, format := range strings.Split(list, ",") {
+		if strings.TrimSpace(format) == "" {
+			continue
+		}
+		if _, err := ParseDateLayout(format); err != nil {
+			return nil, err
+		}
+		formats = append(formats, strings.TrimSpace(format))
+	}
+	return formats, nil
+}
+
+// parseReportDate parses a date of the report in Europe/Warsaw time with
+// the first matching format or as an Excel serial date.
+func parseReportDate(value string, formats []string) (time.Time, error) {
+	if len(formats) == 0 {
+		formats = DefaultDateFormats
+	}
+
+	value = strings.TrimSpace(value)
+	for _, format := range formats {
+		layout, err := ParseDateLayout(format)
+		if err != nil {
+			continue
+		}
+		if date, err := time.ParseInLocation(layout, value, warsaw); err == nil {
+			return date, nil
+		}
+	}
+
+	if date, ok := parseExcelDate(value); ok {
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a date in any of the formats %v or an Excel serial date", value, strings.Join(formats, ", "))
+}
+
+func parseExcelDate(value string) (time.Time, bool) {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 || serial >= 100000 {
+		return time.Time{}, false
+	}
+
+	days, fraction := math.Modf(serial)
+	day := excelEpoch.AddDate(0, 0, int(days))
+	seconds := int(math.Round(fraction * 24 * 60 * 60))
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, seconds, 0, warsaw), true
+}
+
+func formatApiDate(date time.Time) string {
+	return date.In(warsaw).Format(apiDateLayout)
+}
+
+// Period limits the dates of invoices in the report, both days are
+// included. Zero Start or End leaves the period open on that side.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParsePeriod parses the first and the last day of a period in yyyy-MM-dd
+// format, any of them can be empty.
+func ParsePeriod(start, end string) (Period, error) {
+	var period Period
+	for _, day := range []struct {
+		value string
+		date  *time.Time
+	}{{start, &period.Start}, {end, &period.End}} {
+		if day.value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", day.value, warsaw)
+		if err != nil {
+			return Period{}, fmt.Errorf("%q is not a day in yyyy-MM-dd format", day.value)
+		}
+		*day.date = date
+	}
+
+	if !period.Start.IsZero() && !period.End.IsZero() && period.End.Before(period.Start) {
+		return Period{}, fmt.Errorf("period %v ends before it starts", period)
+	}
+	return period, nil
+}
+
+func (period Period) contains(date time.Time) bool {
+	day := startOfDay(date.In(warsaw))
+
+	if !period.Start.IsZero() && day.Before(startOfDay(period.Start)) {
+		return false
+	}
+	if !period.End.IsZero() && day.After(startOfDay(period.End)) {
+		return false
+	}
+	return true
+}
+
+func (period Period) String() string {
+	start, end := "...", "..."
+	if !period.Start.IsZero() {
+		start = period.Start.Format("2006-01-02")
+	}
+	if !period.End.IsZero() {
+		end = period.End.Format("2006-01-02")
+	}
+	return start + " - " + end
+}
+
+func startOfDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, warsaw)
+}
+
+// checkDate returns the problem of an invoice date, if any.
+func checkDate(value string, options Options) string {
+	date, err := parseReportDate(value, options.DateFormats)
+	if err != nil {
+		return err.Error()
+	}
+
+	today := now().In(warsaw)
+	if startOfDay(date.In(warsaw)).After(startOfDay(today)) {
+		return fmt.Sprintf("date %v is in the future", date.Format("2006-01-02"))
+	}
+
+	if !options.Period.contains(date) {
+		return fmt.Sprintf("date %v is outside of the period %v", date.Format("2006-01-02"), options.Period)
+	}
+
+	return ""
+}
@@ -0,0 +1,102 @@
+package process
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+func TestParseReportDate(t *testing.T) {
+	tests := map[string]string{
+		"20220531120000":      "20220531120000",
+		"20220531":            "20220531000000",
+		"2022-05-31":          "20220531000000",
+		"2022-05-31 08:30:00": "20220531083000",
+		"31.05.2022":          "20220531000000",
+		"44712":               "20220531000000",
+		"44712.5":             "20220531120000",
+		"44651":               "20220331000000",
+	}
+
+	for value, expected := range tests {
+		date, err := parseReportDate(value, nil)
+		if err != nil || formatApiDate(date) != expected {
+			t.Errorf("%q: expected %v, but got %v, %v", value, expected, formatApiDate(date), err)
+		}
+	}
+
+	for _, value := range []string{"", "31/05/2022", "2022-13-01", "0", "20220532"} {
+		if _, err := parseReportDate(value, nil); err == nil {
+			t.Errorf("%q: error was expected", value)
+		}
+	}
+
+	if _, err := parseReportDate("2022-05-31", []string{"dd.MM.yyyy"}); err == nil {
+		t.Errorf("error was expected for a format which is not configured")
+	}
+}
+
+func TestParseReportDateIsInWarsawTime(t *testing.T) {
+	date, err := parseReportDate("2022-05-31 00:30:00", nil)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if utc := date.UTC().Format(apiDateLayout); utc != "20220530223000" {
+		t.Fatalf("unexpected UTC time %v", utc)
+	}
+}
+
+func TestCheckDate(t *testing.T) {
+	previousNow := now
+	now = func() time.Time { return time.Date(2022, 6, 15, 10, 0, 0, 0, warsaw) }
+	t.Cleanup(func() { now = previousNow })
+
+	may := Period{Start: time.Date(2022, 5, 1, 0, 0, 0, 0, warsaw), End: time.Date(2022, 5, 31, 0, 0, 0, 0, warsaw)}
+
+	tests := []struct {
+		value  string
+		period Period
+		valid  bool
+	}{
+		{"20220615235959", Period{}, true},
+		{"20220616000000", Period{}, false},
+		{"20220531235959", may, true},
+		{"20220501000000", may, true},
+		{"20220430235959", may, false},
+		{"20220601000000", may, false},
+	}
+
+	for _, test := range tests {
+		problem := checkDate(test.value, Options{Period: test.period})
+		if (problem == "") != test.valid {
+			t.Errorf("%v in %v: unexpected result %q", test.value, test.period, problem)
+		}
+	}
+}
+
+func TestProcessInvoicesNormalizesDates(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,31.05.2022,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/1,2022-05-31,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/2,44712.5,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	if problems, err := ValidateReport(report, Options{}); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	if _, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 2 || invoices[0].DocDate != "20220531000000" || invoices[1].DocDate != "20220531120000" || invoices[1].DueDate != "20220531120000" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
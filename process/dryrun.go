@@ -0,0 +1,201 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"mrsydar/tkl/k360/client"
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/k360/tax"
+	"mrsydar/tkl/k360/vendor"
+)
+
+type k360Api interface {
+	GetCustomerId(ctx context.Context, data customer.Customer) (string, error)
+	PostCustomer(ctx context.Context, data customer.Customer) (string, error)
+	PostInvoice(ctx context.Context, invoiceData invoice.Invoice) error
+	PostCreditNote(ctx context.Context, creditNote invoice.CreditNote) error
+	GetVendorId(ctx context.Context, data vendor.Vendor) (string, error)
+	PostVendor(ctx context.Context, data vendor.Vendor) (string, error)
+	PostPurchaseInvoice(ctx context.Context, invoiceData invoice.PurchaseInvoice) error
+	GetInvoices(ctx context.Context, from, to time.Time) ([]invoice.Summary, error)
+	GetTaxes(ctx context.Context) ([]tax.Tax, error)
+}
+
+type CustomerLookup struct {
+	Nip        string `json:"nip"`
+	CustomerId string `json:"customerId,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+}
+
+// DryRunReport lists everything a ProcessInvoices run would send to
+// Księgowość360 without sending it.
+type DryRunReport struct {
+	CustomerLookups  []CustomerLookup          `json:"customerLookups"`
+	WhiteListLookups []string                  `json:"whiteListLookups"`
+	NewCustomers     []customer.Customer       `json:"newCustomers"`
+	Invoices         []invoice.Invoice         `json:"invoices"`
+	CreditNotes      []invoice.CreditNote      `json:"creditNotes"`
+	VendorLookups    []CustomerLookup          `json:"vendorLookups"`
+	NewVendors       []vendor.Vendor           `json:"newVendors"`
+	PurchaseInvoices []invoice.PurchaseInvoice `json:"purchaseInvoices"`
+}
+
+// dryRunApi records the actions of a run instead of performing them. When
+// lookups are enabled customer ids are still looked up in Księgowość360 as
+// it doesn't change anything there, otherwise every customer with NIP is
+// assumed to be new.
+type dryRunApi struct {
+	client  *client.K360Client
+	lookups bool
+
+	mu     sync.Mutex
+	report DryRunReport
+}
+
+func newDryRunApi(client *client.K360Client, lookups bool) *dryRunApi {
+	return &dryRunApi{
+		client:  client,
+		lookups: lookups,
+		report: DryRunReport{
+			CustomerLookups:  make([]CustomerLookup, 0),
+			WhiteListLookups: make([]string, 0),
+			NewCustomers:     make([]customer.Customer, 0),
+			Invoices:         make([]invoice.Invoice, 0),
+			CreditNotes:      make([]invoice.CreditNote, 0),
+			VendorLookups:    make([]CustomerLookup, 0),
+			NewVendors:       make([]vendor.Vendor, 0),
+			PurchaseInvoices: make([]invoice.PurchaseInvoice, 0),
+		},
+	}
+}
+
+func (api *dryRunApi) GetCustomerId(ctx context.Context, data customer.Customer) (string, error) {
+	if !api.lookups {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		api.report.CustomerLookups = append(api.report.CustomerLookups, CustomerLookup{Nip: data.Nip, Skipped: true})
+		api.report.WhiteListLookups = append(api.report.WhiteListLookups, data.Nip)
+		return "", customer.ErrNotFound
+	}
+
+	customerId, err := api.client.GetCustomerId(ctx, data)
+
+	lookup := CustomerLookup{Nip: data.Nip, CustomerId: customerId}
+	if err != nil {
+		lookup.Error = err.Error()
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.CustomerLookups = append(api.report.CustomerLookups, lookup)
+
+	if errors.Is(err, customer.ErrNotFound) {
+		api.report.WhiteListLookups = append(api.report.WhiteListLookups, data.Nip)
+	}
+
+	return customerId, err
+}
+
+func (api *dryRunApi) PostCustomer(ctx context.Context, data customer.Customer) (string, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.NewCustomers = append(api.report.NewCustomers, data)
+	return "dry-run:" + data.Nip, nil
+}
+
+func (api *dryRunApi) PostInvoice(ctx context.Context, invoiceData invoice.Invoice) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.Invoices = append(api.report.Invoices, invoiceData)
+	return nil
+}
+
+func (api *dryRunApi) PostCreditNote(ctx context.Context, creditNote invoice.CreditNote) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.CreditNotes = append(api.report.CreditNotes, creditNote)
+	return nil
+}
+
+func (api *dryRunApi) GetVendorId(ctx context.Context, data vendor.Vendor) (string, error) {
+	if !api.lookups {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		api.report.VendorLookups = append(api.report.VendorLookups, CustomerLookup{Nip: data.Nip, Skipped: true})
+		api.report.WhiteListLookups = append(api.report.WhiteListLookups, data.Nip)
+		return "", vendor.ErrNotFound
+	}
+
+	vendorId, err := api.client.GetVendorId(ctx, data)
+
+	lookup := CustomerLookup{Nip: data.Nip, CustomerId: vendorId}
+	if err != nil {
+		lookup.Error = err.Error()
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.VendorLookups = append(api.report.VendorLookups, lookup)
+
+	if errors.Is(err, vendor.ErrNotFound) {
+		api.report.WhiteListLookups = append(api.report.WhiteListLookups, data.Nip)
+	}
+
+	return vendorId, err
+}
+
+func (api *dryRunApi) PostVendor(ctx context.Context, data vendor.Vendor) (string, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.NewVendors = append(api.report.NewVendors, data)
+	return "dry-run:" + data.Nip, nil
+}
+
+func (api *dryRunApi) PostPurchaseInvoice(ctx context.Context, invoiceData invoice.PurchaseInvoice) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.report.PurchaseInvoices = append(api.report.PurchaseInvoices, invoiceData)
+	return nil
+}
+
+func (api *dryRunApi) GetInvoices(ctx context.Context, from, to time.Time) ([]invoice.Summary, error) {
+	if !api.lookups {
+		return nil, nil
+	}
+	return api.client.GetInvoices(ctx, from, to)
+}
+
+func (api *dryRunApi) GetTaxes(ctx context.Context) ([]tax.Tax, error) {
+	if !api.lookups {
+		return nil, nil
+	}
+	return api.client.GetTaxes(ctx)
+}
+
+func (api *dryRunApi) writeReport(path string) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	data, err := json.MarshalIndent(api.report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
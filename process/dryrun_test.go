@@ -0,0 +1,94 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+func readDryRunReport(t *testing.T) DryRunReport {
+	data, err := os.ReadFile(DryRunReportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report DryRunReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestProcessInvoicesDryRun(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{"5260250995": "SZAMOTULSKA 40/1A, 60-366 POZNAŃ"})
+	knownId := server.AddCustomer(customer.Customer{Name: "KNOWN", Nip: "7792465289"})
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,5260250995,10.00,0.80,tax-8,,P3,Product 3",
+	)
+
+	options := Options{DryRun: true, DryRunLookups: true}
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if len(server.Customers()) != 2 || len(server.Invoices()) != 0 {
+		t.Fatalf("nothing should be sent in dry run")
+	}
+
+	if _, err := os.Stat(SkippedInvoicesPath); !os.IsNotExist(err) {
+		t.Fatalf("skipped invoices file should not be touched in dry run")
+	}
+
+	dryRun := readDryRunReport(t)
+
+	if len(dryRun.CustomerLookups) != 2 || dryRun.CustomerLookups[0].CustomerId != knownId || dryRun.CustomerLookups[1].Error == "" {
+		t.Fatalf("unexpected customer lookups: %+v", dryRun.CustomerLookups)
+	}
+
+	if len(dryRun.WhiteListLookups) != 1 || dryRun.WhiteListLookups[0] != "5260250995" {
+		t.Fatalf("unexpected white list lookups: %v", dryRun.WhiteListLookups)
+	}
+
+	if len(dryRun.NewCustomers) != 1 || dryRun.NewCustomers[0].Nip != "5260250995" || dryRun.NewCustomers[0].City != "POZNAŃ" {
+		t.Fatalf("unexpected new customers: %+v", dryRun.NewCustomers)
+	}
+
+	if len(dryRun.Invoices) != 3 || dryRun.Invoices[0].Customer.Id != knownId || dryRun.Invoices[2].Customer.Id != "dry-run:5260250995" {
+		t.Fatalf("unexpected invoices: %+v", dryRun.Invoices)
+	}
+}
+
+func TestProcessInvoicesDryRunWithoutLookups(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{})
+	server.AddCustomer(customer.Customer{Name: "KNOWN", Nip: "7792465289"})
+
+	report := writeReport(t, "FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1")
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{DryRun: true}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	dryRun := readDryRunReport(t)
+	if len(dryRun.CustomerLookups) != 1 || !dryRun.CustomerLookups[0].Skipped || len(dryRun.WhiteListLookups) != 1 {
+		t.Fatalf("unexpected dry run report: %+v", dryRun)
+	}
+}
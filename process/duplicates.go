@@ -0,0 +1,159 @@
+package process
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const LedgerPath = "upload_ledger.csv"
+
+// ledger remembers every invoice posted by tkl, so re-running a report never
+// posts an invoice twice even if it can't be found in Księgowość360 yet.
+type ledger struct {
+	posted   map[string]bool
+	file     *os.File
+	writer   *csv.Writer
+	readOnly bool
+}
+
+func ledgerKey(apiId, invoiceNo string) string {
+	return apiId + "\x00" + invoiceNo
+}
+
+func openLedger(path string, readOnly bool) (*ledger, error) {
+	l := &ledger{posted: make(map[string]bool), readOnly: readOnly}
+
+	file, err := os.Open(path)
+	if err == nil {
+		records, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upload ledger %v: %v", path, err)
+		}
+
+		for _, record := range records {
+			if len(record) >= 2 {
+				l.posted[ledgerKey(record[0], record[1])] = true
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open upload ledger %v: %v", path, err)
+	}
+
+	if readOnly {
+		return l, nil
+	}
+
+	l.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload ledger %v: %v", path, err)
+	}
+	l.writer = csv.NewWriter(l.file)
+
+	return l, nil
+}
+
+func (l *ledger) contains(apiId, invoiceNo string) bool {
+	return l.posted[ledgerKey(apiId, invoiceNo)]
+}
+
+func (l *ledger) add(apiId, invoiceNo string) error {
+	l.posted[ledgerKey(apiId, invoiceNo)] = true
+
+	if l.readOnly {
+		return nil
+	}
+
+	l.writer.Write([]string{apiId, invoiceNo, time.Now().Format(time.RFC3339)})
+	l.writer.Flush()
+	return l.writer.Error()
+}
+
+func (l *ledger) close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// existingInvoiceNumbers returns numbers of invoices already present in
+// Księgowość360 in the months covered by the report.
+func existingInvoiceNumbers(ctx context.Context, client k360Api, csvPath string, columns columnIndex, options Options) (map[string]bool, error) {
+	from, to, err := reportPeriod(csvPath, columns, options)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make(map[string]bool)
+	if from.IsZero() {
+		return numbers, nil
+	}
+
+	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+
+	invoices, err := client.GetInvoices(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list existing invoices: %v", err)
+	}
+
+	for _, invoice := range invoices {
+		numbers[invoice.No] = true
+	}
+
+	return numbers, nil
+}
+
+func reportPeriod(csvPath string, columns columnIndex, options Options) (time.Time, time.Time, error) {
+	var from, to time.Time
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return from, to, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	if _, err := reader.Read(); err != nil {
+		return from, to, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	for {
+		rawRecord, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return from, to, nil
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return from, to, fmt.Errorf("failed to read record: %v", err)
+		}
+
+		record, err := columns.record(rawRecord, 0)
+		if err != nil {
+			continue
+		}
+
+		date, err := parseReportDate(record.Date, options.DateFormats)
+		if err != nil {
+			continue
+		}
+
+		if from.IsZero() || date.Before(from) {
+			from = date
+		}
+		if to.IsZero() || date.After(to) {
+			to = date
+		}
+	}
+}
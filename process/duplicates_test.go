@@ -0,0 +1,70 @@
+package process
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+)
+
+func TestProcessInvoicesSkipsDuplicates(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	server.AddInvoice(invoice.Invoice{No: "FV/1", DocDate: "20220530120000"})
+
+	if err := os.WriteFile(LedgerPath, []byte("test-id,FV/2,2022-06-01T10:00:00Z\nother-id,FV/3,2022-06-01T10:00:00Z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 0 || summary.Duplicates != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 2 || invoices[1].No != "FV/3" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	summary, err = ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Resumed != 3 || len(server.Invoices()) != 2 {
+		t.Fatalf("re-running the report should not post anything: %+v", summary)
+	}
+}
+
+func TestLedgerReadOnly(t *testing.T) {
+	path := t.TempDir() + "/ledger.csv"
+
+	l, err := openLedger(path, true)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if err := l.add("test-id", "FV/1"); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if !l.contains("test-id", "FV/1") || l.contains("other-id", "FV/1") {
+		t.Fatalf("unexpected ledger contents")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("read only ledger should not be written")
+	}
+}
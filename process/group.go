@@ -0,0 +1,188 @@
+package process
+
+import (
+	"fmt"
+
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/nbp"
+)
+
+// Grouping decides which records of a report make up one invoice.
+type Grouping int
+
+const (
+	// GroupConsecutive joins consecutive records with the same invoice
+	// number.
+	GroupConsecutive Grouping = iota
+	// GroupAll joins all records with the same invoice number wherever
+	// they are in the report.
+	GroupAll
+)
+
+func ParseGrouping(value string) (Grouping, error) {
+	switch value {
+	case "", "consecutive":
+		return GroupConsecutive, nil
+	case "all":
+		return GroupAll, nil
+	}
+	return GroupConsecutive, fmt.Errorf("unknown grouping %q, expected consecutive or all", value)
+}
+
+// invoiceRecords are the records of one invoice. ordinals are the positions
+// of the records in the report used for progress reporting and problems are
+// validation problems of any of them. lines are the amounts of the records
+// and rate is the exchange rate of a foreign currency invoice, both are set
+// before the invoice is posted.
+type invoiceRecords struct {
+	records  []Record
+	ordinals []int
+	problems []string
+	lines    []invoice.Line
+	rate     *nbp.Rate
+}
+
+func (group *invoiceRecords) no() string {
+	return group.records[0].No
+}
+
+func (group *invoiceRecords) first() Record {
+	return group.records[0]
+}
+
+func (group *invoiceRecords) add(record Record, ordinal int, problems []string) {
+	group.records = append(group.records, record)
+	group.ordinals = append(group.ordinals, ordinal)
+	group.problems = append(group.problems, problems...)
+}
+
+// grouper collects records into invoices. Invoices which can't get any more
+// records are passed to emit, with GroupAll that is only on flush. Records
+// are joined by their invoice key, see Record.invoiceKey.
+type grouper struct {
+	grouping Grouping
+	mode     Mode
+	emit     func(group *invoiceRecords)
+
+	current *invoiceRecords
+	byKey   map[string]*invoiceRecords
+	order   []*invoiceRecords
+}
+
+func newGrouper(grouping Grouping, mode Mode, emit func(group *invoiceRecords)) *grouper {
+	return &grouper{grouping: grouping, mode: mode, emit: emit, byKey: make(map[string]*invoiceRecords)}
+}
+
+func (g *grouper) add(record Record, ordinal int, problems []string) {
+	key := record.invoiceKey(g.mode)
+	if g.grouping == GroupAll {
+		group, ok := g.byKey[key]
+		if !ok {
+			group = &invoiceRecords{}
+			g.byKey[key] = group
+			g.order = append(g.order, group)
+		}
+		group.add(record, ordinal, problems)
+		return
+	}
+
+	if g.current != nil && g.current.first().invoiceKey(g.mode) != key {
+		g.emit(g.current)
+		g.current = nil
+	}
+	if g.current == nil {
+		g.current = &invoiceRecords{}
+	}
+	g.current.add(record, ordinal, problems)
+}
+
+func (g *grouper) flush() {
+	if g.current != nil {
+		g.emit(g.current)
+		g.current = nil
+	}
+
+	for _, group := range g.order {
+		g.emit(group)
+	}
+	g.order = nil
+	g.byKey = make(map[string]*invoiceRecords)
+}
+
+// invoiceFieldsProblem checks that the record has the same invoice-level
+// fields as the first record of its invoice.
+func invoiceFieldsProblem(first, record Record) (string, string) {
+	switch {
+	case record.Date != first.Date:
+		return ColumnDate, fmt.Sprintf("date %q differs from %q at line %v of the same invoice", record.Date, first.Date, first.Line)
+	case record.CustomerNip != first.CustomerNip:
+		return ColumnCustomerNip, fmt.Sprintf("customer nip %q differs from %q at line %v of the same invoice", record.CustomerNip, first.CustomerNip, first.Line)
+	case record.CustomerNip == "" && record.CustomerId != first.CustomerId:
+		return ColumnCustomerId, fmt.Sprintf("customer id %q differs from %q at line %v of the same invoice", record.CustomerId, first.CustomerId, first.Line)
+	case record.Currency != first.Currency:
+		return ColumnCurrency, fmt.Sprintf("currency %q differs from %q at line %v of the same invoice", record.Currency, first.Currency, first.Line)
+	case record.DocType != first.DocType:
+		return ColumnDocType, fmt.Sprintf("document type %q differs from %q at line %v of the same invoice", record.DocType, first.DocType, first.Line)
+	case record.OriginalNo != first.OriginalNo:
+		return ColumnOriginalNo, fmt.Sprintf("original invoice number %q differs from %q at line %v of the same invoice", record.OriginalNo, first.OriginalNo, first.Line)
+	case record.OriginalDate != first.OriginalDate:
+		return ColumnOriginalDate, fmt.Sprintf("original invoice date %q differs from %q at line %v of the same invoice", record.OriginalDate, first.OriginalDate, first.Line)
+	case record.CorrectionReason != first.CorrectionReason:
+		return ColumnCorrectionReason, fmt.Sprintf("correction reason %q differs from %q at line %v of the same invoice", record.CorrectionReason, first.CorrectionReason, first.Line)
+	case record.DueDate != first.DueDate:
+		return ColumnDueDate, fmt.Sprintf("due date %q differs from %q at line %v of the same invoice", record.DueDate, first.DueDate, first.Line)
+	case record.TransactionDate != first.TransactionDate:
+		return ColumnTransactionDate, fmt.Sprintf("transaction date %q differs from %q at line %v of the same invoice", record.TransactionDate, first.TransactionDate, first.Line)
+	}
+	return "", ""
+}
+
+func getInvoiceFromRecords(records []Record, lines []invoice.Line, customerId string) invoice.Invoice {
+	first := records[0]
+
+	rows := make([]invoice.Row, 0, len(records))
+	taxIds := make([]string, 0)
+	taxes := make(map[string]invoice.Decimal)
+	var total invoice.Decimal
+
+	for i, record := range records {
+		line := lines[i]
+		rows = append(rows, line.Row(record.TaxId, invoice.Item{
+			Code:        record.ProductCode,
+			Description: record.ProductDescription,
+		}))
+
+		if _, ok := taxes[record.TaxId]; !ok {
+			taxIds = append(taxIds, record.TaxId)
+		}
+		taxes[record.TaxId] = taxes[record.TaxId].Add(line.Tax)
+		total = total.Add(line.Gross)
+	}
+
+	taxAmounts := make([]invoice.TaxAmount, 0, len(taxIds))
+	for _, taxId := range taxIds {
+		taxAmounts = append(taxAmounts, invoice.TaxAmount{
+			TaxId:  taxId,
+			Amount: taxes[taxId],
+		})
+	}
+
+	dueDate, transactionDate := first.DueDate, first.TransactionDate
+	if dueDate == "" {
+		dueDate = first.Date
+	}
+	if transactionDate == "" {
+		transactionDate = first.Date
+	}
+
+	return invoice.Invoice{
+		Customer:        invoice.Customer{Id: customerId},
+		DocDate:         first.Date,
+		DueDate:         dueDate,
+		TransactionDate: transactionDate,
+		No:              first.No,
+		Rows:            rows,
+		TaxAmounts:      taxAmounts,
+		TotalAmount:     total,
+	}
+}
@@ -0,0 +1,169 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+)
+
+func decimal(t *testing.T, value string) invoice.Decimal {
+	d, err := invoice.ParseDecimal(value)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	return d
+}
+
+func TestGetInvoiceFromRecords(t *testing.T) {
+	records := []Record{
+		{No: "FV/1", Date: "20220531120000", Net: "100.00", Tax: "23.00", TaxId: "tax-23", ProductCode: "P1", Quantity: "3"},
+		{No: "FV/1", Date: "20220531120000", Net: "50.00", Tax: "4.00", TaxId: "tax-8", ProductCode: "P2"},
+		{No: "FV/1", Date: "20220531120000", Net: "10.50", Tax: "2.42", TaxId: "tax-23", ProductCode: "P3", Quantity: "1.5"},
+	}
+
+	lines, err := invoiceLines(records, AmountsNet, nil)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	actual := getInvoiceFromRecords(records, lines, "customer-1")
+
+	expected := invoice.Invoice{
+		Customer:        invoice.Customer{Id: "customer-1"},
+		DocDate:         "20220531120000",
+		DueDate:         "20220531120000",
+		TransactionDate: "20220531120000",
+		No:              "FV/1",
+		Rows: []invoice.Row{
+			{TaxId: "tax-23", Item: invoice.Item{Code: "P1"}, Quantity: decimal(t, "3.00"), Price: decimal(t, "33.3333")},
+			{TaxId: "tax-8", Item: invoice.Item{Code: "P2"}, Quantity: decimal(t, "1.00"), Price: decimal(t, "50.00")},
+			{TaxId: "tax-23", Item: invoice.Item{Code: "P3"}, Quantity: decimal(t, "1.50"), Price: decimal(t, "7.00")},
+		},
+		TaxAmounts: []invoice.TaxAmount{
+			{TaxId: "tax-23", Amount: decimal(t, "25.42")},
+			{TaxId: "tax-8", Amount: decimal(t, "4.00")},
+		},
+		TotalAmount: decimal(t, "189.92"),
+	}
+
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected invoice %+v, but got %+v", expected, actual)
+	}
+}
+
+func TestProcessInvoicesGroupsRows(t *testing.T) {
+	tests := []struct {
+		grouping Grouping
+		skipped  int
+	}{
+		// the last row repeats the number of an earlier invoice
+		{GroupConsecutive, 1},
+		{GroupAll, 0},
+	}
+
+	for _, test := range tests {
+		k360, server := setupTest(t)
+		walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+		report := writeReportWithHeader(t, testHeader+",quantity",
+			"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1,2",
+			"FV/1,20220531120000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2,",
+			"FV/2,20220531130000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3,",
+			"FV/1,20220531120000,,10.00,2.30,tax-23,"+walkInId+",P4,Product 4,",
+		)
+
+		options := Options{Grouping: test.grouping, IgnoreValidationErrors: true}
+		summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+		if err != nil {
+			t.Fatalf("error was not expected: %v", err)
+		}
+
+		if summary.Records != 4 || summary.Skipped != test.skipped || summary.Duplicates != 0 {
+			t.Fatalf("grouping %v: unexpected summary: %+v", test.grouping, summary)
+		}
+
+		if test.grouping == GroupConsecutive {
+			if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][7] != "P4" || skipped[0][10] != string(StageValidation) {
+				t.Fatalf("unexpected skipped invoices: %v", skipped)
+			}
+		}
+
+		var numbers []string
+		for _, posted := range server.Invoices() {
+			numbers = append(numbers, posted.No)
+		}
+		if !reflect.DeepEqual(numbers, []string{"FV/1", "FV/2"}) {
+			t.Fatalf("grouping %v: unexpected invoices %v", test.grouping, numbers)
+		}
+
+		first := server.Invoices()[0]
+		if len(first.Rows) < 2 || first.Rows[0].Quantity.String() != "2.00" || first.Rows[0].Price.String() != "50.00" {
+			t.Fatalf("unexpected first invoice: %+v", first)
+		}
+
+		if test.grouping == GroupAll && (len(first.Rows) != 3 || first.TaxAmounts[0].Amount.String() != "25.30" || first.TotalAmount.String() != "189.30") {
+			t.Fatalf("unexpected grouped invoice: %+v", first)
+		}
+	}
+}
+
+func TestValidateReportSplitInvoice(t *testing.T) {
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,c,P2,Product 2",
+		"FV/1,20220531120000,,10.00,2.30,tax-23,c,P3,Product 3",
+		"FV/1,20220531120000,,10.00,2.30,tax-23,c,P4,Product 4",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if len(problems) != 2 || problems[0].Line != 4 || problems[1].Line != 5 || problems[0].Column != ColumnNo {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	if problems, err := ValidateReport(report, Options{Grouping: GroupAll}); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result with all records grouped: %v, %v", problems, err)
+	}
+}
+
+func TestProcessInvoicesSkipsWholeInvalidInvoice(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/1,20220601120000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/2,20220531130000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Column != ColumnDate {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{IgnoreValidationErrors: true}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 2 || skipped[0][0] != "FV/1" || skipped[1][0] != "FV/1" {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 1 || invoices[0].No != "FV/2" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
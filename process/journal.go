@@ -0,0 +1,127 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const JournalDir = "journal"
+
+const (
+	outcomePosted    = "posted"
+	outcomeSkipped   = "skipped"
+	outcomeDuplicate = "duplicate"
+)
+
+// journal records the outcome of every record of a report in a file named
+// after the report hash, the API ID and the mode, so that a restarted run of
+// the same report resumes where the previous one stopped. Uploads of the
+// report to another company or in the other mode have their own journal.
+type journal struct {
+	previous map[string]string
+	file     *os.File
+	writer   *csv.Writer
+	readOnly bool
+}
+
+func reportHash(csvPath string) (string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// journalName returns the name of the journal file of the report uploaded
+// with the API ID in the mode.
+func journalName(reportHash, apiId string, mode Mode) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%v\x00%v\x00%v", reportHash, apiId, mode)
+	return hex.EncodeToString(h.Sum(nil)) + ".csv"
+}
+
+func openJournal(dir, csvPath, apiId string, mode Mode, readOnly bool) (*journal, error) {
+	hash, err := reportHash(csvPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash report: %v", err)
+	}
+	path := filepath.Join(dir, journalName(hash, apiId, mode))
+
+	j := &journal{previous: make(map[string]string), readOnly: readOnly}
+
+	file, err := os.Open(path)
+	if err == nil {
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal %v: %v", path, err)
+		}
+
+		for _, record := range records {
+			if len(record) >= 2 {
+				j.previous[record[0]] = record[1]
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open journal %v: %v", path, err)
+	}
+
+	if readOnly {
+		return j, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %v", err)
+	}
+
+	j.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %v: %v", path, err)
+	}
+	j.writer = csv.NewWriter(j.file)
+
+	return j, nil
+}
+
+// completed reports whether the invoice was posted or found to be a
+// duplicate in a previous run of the report.
+func (j *journal) completed(invoiceNo string) bool {
+	outcome := j.previous[invoiceNo]
+	return outcome == outcomePosted || outcome == outcomeDuplicate
+}
+
+func (j *journal) record(invoiceNo, outcome string) error {
+	if j.readOnly {
+		return nil
+	}
+
+	j.writer.Write([]string{invoiceNo, outcome, time.Now().Format(time.RFC3339)})
+	j.writer.Flush()
+	if err := j.writer.Error(); err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
+
+func (j *journal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
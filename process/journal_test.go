@@ -0,0 +1,82 @@
+package process
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"mrsydar/tkl/k360/client"
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/k360test"
+)
+
+func TestProcessInvoicesResumesFromJournal(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := ProcessInvoices(ctx, k360, report, Options{}, func(message string, recordsNumber, currentRecord int) {
+		if currentRecord == 1 {
+			cancel()
+		}
+	})
+	if err == nil {
+		t.Fatalf("error was expected")
+	}
+
+	if err := os.Remove(LedgerPath); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Resumed != 1 || summary.Skipped != 0 || summary.Duplicates != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 3 || invoices[0].No != "FV/1" || invoices[1].No != "FV/2" || invoices[2].No != "FV/3" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestProcessInvoicesJournalPerCompany(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	other := k360test.NewServer("other-id", "other-key")
+	t.Cleanup(other.Close)
+	otherWalkInId := other.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	otherK360 := *client.New("other-id", "other-key", client.WithBaseURL(other.URL), client.WithRateLimit(0))
+
+	options := Options{DefaultCustomerId: walkInId}
+	report := writeReport(t, "FV/1,20220531120000,,100.00,23.00,tax-23,,P1,Product 1")
+
+	if _, err := ProcessInvoices(context.Background(), k360, report, options, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	options.DefaultCustomerId = otherWalkInId
+	summary, err := ProcessInvoices(context.Background(), otherK360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Resumed != 0 || summary.Duplicates != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if len(server.Invoices()) != 1 || len(other.Invoices()) != 1 {
+		t.Fatalf("the report should be uploaded to both companies")
+	}
+}
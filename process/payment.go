@@ -0,0 +1,81 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePaymentDays parses a payment term in days, an empty value is zero.
+func ParsePaymentDays(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("%q is not a number of days like 14", value)
+	}
+	return days, nil
+}
+
+// checkPayment adds problems of the due and transaction dates and the
+// payment term of the record.
+func checkPayment(record Record, options Options, addProblem func(column, format string, args ...interface{})) {
+	date, dateErr := parseReportDate(record.Date, options.DateFormats)
+
+	if record.DueDate != "" {
+		dueDate, err := parseReportDate(record.DueDate, options.DateFormats)
+		if err != nil {
+			addProblem(ColumnDueDate, "%v", err)
+		} else if dateErr == nil && startOfDay(dueDate).Before(startOfDay(date)) {
+			addProblem(ColumnDueDate, "due date %v is before the invoice date %v", dueDate.Format("2006-01-02"), date.Format("2006-01-02"))
+		}
+
+		if strings.TrimSpace(record.PaymentDays) != "" {
+			addProblem(ColumnPaymentDays, "payment days can't be set together with the due date")
+		}
+	}
+
+	if _, err := ParsePaymentDays(record.PaymentDays); err != nil {
+		addProblem(ColumnPaymentDays, "%v", err)
+	}
+
+	if record.TransactionDate != "" {
+		if _, err := parseReportDate(record.TransactionDate, options.DateFormats); err != nil {
+			addProblem(ColumnTransactionDate, "%v", err)
+		}
+	}
+}
+
+// normalizedPayment sets the due date from the payment term when it's not
+// in the report and converts the due and transaction dates to the format of
+// the Księgowość360 API. The transaction date defaults to the invoice date.
+func (record Record) normalizedPayment(options Options) Record {
+	date, err := parseReportDate(record.Date, options.DateFormats)
+	if err != nil {
+		return record
+	}
+
+	if record.DueDate == "" {
+		days := options.DefaultPaymentDays
+		if strings.TrimSpace(record.PaymentDays) != "" {
+			days, err = ParsePaymentDays(record.PaymentDays)
+			if err != nil {
+				return record
+			}
+		}
+		record.DueDate = formatApiDate(date.AddDate(0, 0, days))
+	} else if dueDate, err := parseReportDate(record.DueDate, options.DateFormats); err == nil {
+		record.DueDate = formatApiDate(dueDate)
+	}
+
+	if record.TransactionDate == "" {
+		record.TransactionDate = formatApiDate(date)
+	} else if transactionDate, err := parseReportDate(record.TransactionDate, options.DateFormats); err == nil {
+		record.TransactionDate = formatApiDate(transactionDate)
+	}
+
+	return record
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"context"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+const paymentHeader = testHeader + ",due_date,transaction_date,payment_days"
+
+func TestProcessInvoicesPaymentTerms(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t, paymentHeader,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1,2022-06-14,2022-05-30,",
+		"FV/2,20220531120000,,10.00,0.80,tax-8,"+walkInId+",P2,Product 2,,,14",
+		"FV/3,20220531120000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3,,,",
+	)
+
+	options := Options{TaxTolerance: DefaultTaxTolerance, DefaultPaymentDays: 7}
+	if problems, err := ValidateReport(report, options); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	if _, err := ProcessInvoices(context.Background(), k360, report, options, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 3 {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+
+	first := invoices[0]
+	if first.DueDate != "20220614000000" || first.TransactionDate != "20220530000000" {
+		t.Fatalf("unexpected first invoice: %+v", first)
+	}
+
+	second := invoices[1]
+	if second.DueDate != "20220614120000" || second.TransactionDate != "20220531120000" {
+		t.Fatalf("unexpected second invoice: %+v", second)
+	}
+
+	if third := invoices[2]; third.DueDate != "20220607120000" || third.TransactionDate != "20220531120000" {
+		t.Fatalf("unexpected third invoice: %+v", third)
+	}
+}
+
+func TestValidateReportPayment(t *testing.T) {
+	report := writeReportWithHeader(t, paymentHeader,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,2022-05-30,,",
+		"FV/2,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,2022-06-14,,14",
+		"FV/3,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,,2022/05/30,-1",
+		"FV/4,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,,,",
+		"FV/4,20220531120000,,100.00,23.00,tax-23,c,P1,Product 1,,,21",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	expected := []struct {
+		line   int
+		column string
+	}{
+		{2, ColumnDueDate},
+		{3, ColumnPaymentDays},
+		{4, ColumnPaymentDays},
+		{4, ColumnTransactionDate},
+		{6, ColumnDueDate},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %v problems, but got %v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if problem.Line != expected[i].line || problem.Column != expected[i].column {
+			t.Errorf("expected problem at line %v in %v, but got %v", expected[i].line, expected[i].column, problem)
+		}
+	}
+}
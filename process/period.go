@@ -0,0 +1,149 @@
+package process
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+// MonthCheck decides what happens when invoices of the report are dated
+// outside of Options.Month.
+type MonthCheck int
+
+const (
+	// MonthWarn only reports invoices outside of the month, the caller
+	// decides whether to upload them.
+	MonthWarn MonthCheck = iota
+	// MonthBlock refuses to upload a report with any invoice outside of the
+	// month.
+	MonthBlock
+)
+
+func ParseMonthCheck(value string) (MonthCheck, error) {
+	switch value {
+	case "", "warn":
+		return MonthWarn, nil
+	case "block":
+		return MonthBlock, nil
+	}
+	return MonthWarn, fmt.Errorf("unknown month check %q, expected warn or block", value)
+}
+
+// ParseMonth parses an accounting month in yyyy-MM format, an empty month
+// is zero.
+func ParseMonth(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	month, err := time.ParseInLocation("2006-01", value, warsaw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a month in yyyy-MM format", value)
+	}
+	return month, nil
+}
+
+// OutOfMonth describes invoices dated outside of the accounting month.
+// Gross is the sum of their gross values.
+type OutOfMonth struct {
+	Month    time.Time
+	Invoices []string
+	Gross    invoice.Decimal
+}
+
+func (out OutOfMonth) String() string {
+	return fmt.Sprintf("%v invoices with gross value %v are dated outside of %v", len(out.Invoices), out.Gross, out.Month.Format("2006-01"))
+}
+
+type MonthError struct {
+	OutOfMonth OutOfMonth
+}
+
+func (err *MonthError) Error() string {
+	return err.OutOfMonth.String()
+}
+
+// CheckMonth finds invoices of the report dated outside of Options.Month.
+// Records with invalid dates or amounts are left to the validation.
+func CheckMonth(csvPath string, options Options) (OutOfMonth, error) {
+	out := OutOfMonth{Month: options.Month}
+	if options.Month.IsZero() {
+		return out, nil
+	}
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return out, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return out, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	columns, err := newColumnIndex(header, options)
+	if err != nil {
+		return out, err
+	}
+
+	start := startOfMonth(options.Month)
+	end := start.AddDate(0, 1, 0)
+
+	found := make(map[string]bool)
+	for {
+		rawRecord, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return out, fmt.Errorf("failed to read record: %v", err)
+		}
+
+		record, err := columns.record(rawRecord, 0)
+		if err != nil {
+			continue
+		}
+
+		date, err := parseReportDate(record.Date, options.DateFormats)
+		if err != nil || (!date.Before(start) && date.Before(end)) {
+			continue
+		}
+
+		if !found[record.No] {
+			found[record.No] = true
+			out.Invoices = append(out.Invoices, record.No)
+		}
+		out.Gross = out.Gross.Add(recordGross(record, options.Amounts))
+	}
+}
+
+func startOfMonth(date time.Time) time.Time {
+	date = date.In(warsaw)
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, warsaw)
+}
+
+// recordGross returns the gross value of the record, zero if it's invalid.
+func recordGross(record Record, amounts Amounts) invoice.Decimal {
+	if amounts == AmountsGross {
+		gross, _ := invoice.ParseAmount(record.Gross)
+		return gross
+	}
+
+	net, _ := invoice.ParseAmount(record.Net)
+	tax, _ := invoice.ParseAmount(record.Tax)
+	return net.Add(tax)
+}
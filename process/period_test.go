@@ -0,0 +1,67 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+func TestCheckMonth(t *testing.T) {
+	report := writeReport(t,
+		"FV/1,20220430235959,,100.00,23.00,tax-23,c,P1,Product 1",
+		"FV/1,20220430235959,,50.00,4.00,tax-8,c,P2,Product 2",
+		"FV/2,20220501000000,,10.00,0.80,tax-8,c,P3,Product 3",
+		"FV/3,20220531235959,,10.00,0.80,tax-8,c,P3,Product 3",
+		"FV/4,01.06.2022,,\"1 000,00\",230.00,tax-23,c,P4,Product 4",
+		"FV/5,bad date,,10.00,0.80,tax-8,c,P3,Product 3",
+	)
+
+	month, err := ParseMonth("2022-05")
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	out, err := CheckMonth(report, Options{Month: month})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if !reflect.DeepEqual(out.Invoices, []string{"FV/1", "FV/4"}) || out.Gross.String() != "1407.00" {
+		t.Fatalf("unexpected invoices outside of the month: %v", out)
+	}
+
+	if out, err := CheckMonth(report, Options{}); err != nil || len(out.Invoices) != 0 {
+		t.Fatalf("nothing should be checked without a month: %v, %v", out, err)
+	}
+}
+
+func TestProcessInvoicesMonthCheck(t *testing.T) {
+	month, _ := ParseMonth("2022-06")
+
+	for _, check := range []MonthCheck{MonthWarn, MonthBlock} {
+		k360, server := setupTest(t)
+		walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+		report := writeReport(t,
+			"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+			"FV/2,20220601120000,,10.00,0.80,tax-8,"+walkInId+",P2,Product 2",
+		)
+
+		_, err := ProcessInvoices(context.Background(), k360, report, Options{Month: month, MonthCheck: check}, noProgress)
+
+		var monthErr *MonthError
+		if check == MonthBlock {
+			if !errors.As(err, &monthErr) || len(monthErr.OutOfMonth.Invoices) != 1 || len(server.Invoices()) != 0 {
+				t.Fatalf("expected the upload to be blocked, but got %v and %v invoices", err, len(server.Invoices()))
+			}
+			continue
+		}
+
+		if err != nil || len(server.Invoices()) != 2 {
+			t.Fatalf("expected only a warning, but got %v and %v invoices", err, len(server.Invoices()))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package process
+
+import "sync"
+
+type workerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := &workerPool{jobs: make(chan func())}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				job()
+			}
+		}()
+	}
+
+	return pool
+}
+
+func (pool *workerPool) submit(job func()) {
+	pool.jobs <- job
+}
+
+// wait blocks until all submitted jobs are finished. No jobs can be
+// submitted afterwards.
+func (pool *workerPool) wait() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+// keyedMutex serializes work on the same key, e.g. on the same customer NIP.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*sync.Mutex)}
+}
+
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// orderedProgress reports progress of records finished by concurrent
+// workers in the order of the records in the report.
+type orderedProgress struct {
+	mu       sync.Mutex
+	callback func(message string, recordsNumber, currentRecord int)
+	total    int
+	next     int
+	finished map[int]string
+}
+
+func newOrderedProgress(total int, callback func(message string, recordsNumber, currentRecord int)) *orderedProgress {
+	return &orderedProgress{
+		callback: callback,
+		total:    total,
+		next:     1,
+		finished: make(map[int]string),
+	}
+}
+
+// done marks the record with the given index as finished. Records finished
+// with an empty message advance the progress without reporting it.
+func (progress *orderedProgress) done(index int, message string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	progress.finished[index] = message
+	for {
+		message, ok := progress.finished[progress.next]
+		if !ok {
+			return
+		}
+		delete(progress.finished, progress.next)
+
+		if message != "" {
+			progress.callback(message, progress.total, progress.next)
+		}
+		progress.next++
+	}
+}
@@ -2,46 +2,23 @@ package process
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mrsydar/tkl/k360/client"
-	"mrsydar/tkl/k360/customer"
 	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/nbp"
 	"mrsydar/tkl/taxpayer"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-func getInvoiceFromRecord(record []string, customerId string) invoice.Invoice {
-	return invoice.Invoice{
-		Customer:        invoice.Customer{Id: customerId},
-		DocDate:         record[1],
-		DueDate:         record[1],
-		TransactionDate: record[1],
-		No:              record[0],
-		Rows: []invoice.Row{
-			{
-				TaxId: record[5],
-				Item: invoice.Item{
-					Code:        record[7],
-					Description: record[8],
-				},
-				Quantity: "1",
-				Price:    record[3],
-			},
-		},
-		TaxAmounts: []invoice.TaxAmount{
-			{
-				TaxId:  record[5],
-				Amount: record[4],
-			},
-		},
-		TotalAmount: record[3],
-	}
-}
-
 func countRecords(path string) (int, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -57,135 +34,657 @@ func countRecords(path string) (int, error) {
 	return count - 1, scanner.Err()
 }
 
-func ProcessInvoices(client client.K360Client, csvPath string, progressCallback func(message string, recordsNumber, currentRecord int)) error {
-	file, err := os.Create("skipped_invoices.csv")
+var errProcessingCancelled = errors.New("processing cancelled")
+
+const DefaultTaxTolerance = 0.01
+
+// DefaultWorkers is the number of invoices uploaded concurrently unless set
+// otherwise.
+const DefaultWorkers = 4
+
+const (
+	SkippedInvoicesPath       = "skipped_invoices.csv"
+	DryRunSkippedInvoicesPath = "dry_run_skipped_invoices.csv"
+	DryRunReportPath          = "dry_run_report.json"
+)
+
+type Options struct {
+	Columns ColumnMapping
+
+	// IgnoreValidationErrors makes ProcessInvoices upload the valid records
+	// of a report with validation problems instead of refusing to start.
+	IgnoreValidationErrors bool
+
+	// DryRun makes ProcessInvoices write everything it would send to
+	// Księgowość360 to DryRunReportPath instead of sending it. Customer ids
+	// are still looked up when DryRunLookups is set.
+	DryRun        bool
+	DryRunLookups bool
+
+	// Workers is the number of records processed concurrently. Invoices of
+	// the same customer NIP are never created concurrently.
+	Workers int
+
+	// DefaultTaxId and DefaultCustomerId are used for records with empty
+	// tax_id and, when they have no customer NIP, customer_id.
+	DefaultTaxId      string
+	DefaultCustomerId string
+
+	// DefaultPaymentDays is the payment term of records without due_date
+	// and payment_days, their due date is the invoice date when it's zero.
+	DefaultPaymentDays int
+
+	// TaxTolerance is the largest accepted difference between taxes of an
+	// invoice in the report and taxes calculated from its net values, larger
+	// differences make the invoice skipped.
+	TaxTolerance float64
+
+	// Grouping decides which records with the same invoice number are
+	// uploaded as one invoice with several rows.
+	Grouping Grouping
+
+	// Amounts decides whether the net value and tax or the gross value of
+	// records are taken from the report.
+	Amounts Amounts
+
+	// DateFormats are the accepted formats of the date column like
+	// dd.MM.yyyy, DefaultDateFormats when empty. Dates must not be in the
+	// future and, when Period is set, must be in it.
+	DateFormats []string
+	Period      Period
+
+	// Month is the accounting month of the report, when set invoices dated
+	// outside of it are reported by CheckMonth and, with MonthBlock, make
+	// ProcessInvoices refuse to start.
+	Month      time.Time
+	MonthCheck MonthCheck
+
+	// CurrencyRates provides NBP exchange rates of foreign currency
+	// invoices, the NBP web API is used when it's nil.
+	CurrencyRates nbp.Provider
+
+	// Mode decides whether sales or purchase invoices are uploaded.
+	Mode Mode
+}
+
+type Summary struct {
+	Records    int
+	Skipped    int
+	Duplicates int
+	Resumed    int
+}
+
+func ProcessInvoices(ctx context.Context, k360Client client.K360Client, csvPath string, options Options, progressCallback func(message string, recordsNumber, currentRecord int)) (Summary, error) {
+	problems, err := ValidateReport(csvPath, options)
 	if err != nil {
-		return fmt.Errorf("failed to create file for skipped invoices: %v", err)
+		return Summary{}, err
 	}
-	defer file.Close()
 
-	failedInvoicesWriter := csv.NewWriter(file)
-	defer failedInvoicesWriter.Flush()
+	if len(problems) != 0 && !options.IgnoreValidationErrors {
+		return Summary{}, &ValidationError{problems}
+	}
+
+	outOfMonth, err := CheckMonth(csvPath, options)
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(outOfMonth.Invoices) != 0 {
+		if options.MonthCheck == MonthBlock {
+			return Summary{}, &MonthError{outOfMonth}
+		}
+		log.Printf("warning: %v: %v\n", outOfMonth, strings.Join(outOfMonth.Invoices, ", "))
+	}
+
+	invalidLines := make(map[int][]string)
+	for _, problem := range problems {
+		log.Println("validation problem:", problem)
+		invalidLines[problem.Line] = append(invalidLines[problem.Line], problem.String())
+	}
 
 	numberOfRecords, err := countRecords(csvPath)
 	if err != nil {
-		return fmt.Errorf("failed to count lines in file: %v", err)
+		return Summary{}, fmt.Errorf("failed to count lines in file: %v", err)
 	}
 
-	file, err = os.Open(csvPath)
+	file, err := os.Open(csvPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+		return Summary{}, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 
 	header, err := reader.Read()
 	if err != nil {
-		return fmt.Errorf("failed to skip header: %v", err)
+		return Summary{}, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	columns, err := newColumnIndex(header, options)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var api k360Api = &k360Client
+	skippedPath := SkippedInvoicesPath
+
+	if options.DryRun {
+		dryRun := newDryRunApi(&k360Client, options.DryRunLookups)
+		defer func() {
+			if err := dryRun.writeReport(DryRunReportPath); err != nil {
+				log.Println("failed to write dry run report:", err)
+			}
+		}()
+
+		api = dryRun
+		skippedPath = DryRunSkippedInvoicesPath
+	}
+
+	// only sales invoices can be listed, purchase invoices are checked in
+	// the ledger
+	existingInvoices := make(map[string]bool)
+	if options.Mode == ModeSales {
+		existingInvoices, err = existingInvoiceNumbers(ctx, api, csvPath, columns, options)
+		if err != nil {
+			return Summary{}, err
+		}
 	}
-	failedInvoicesWriter.Write(header)
 
-	taxpayerLoader := taxpayer.NewBufferedTaxpayerDataLoader()
-	csvRecordsUnknownNipInvoices := make([][]string, 0)
+	rates, err := loadTaxRates(ctx, api)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	uploadLedger, err := openLedger(LedgerPath, options.DryRun)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer uploadLedger.close()
+
+	runJournal, err := openJournal(JournalDir, csvPath, k360Client.ApiId(), options.Mode, options.DryRun)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer runJournal.close()
+
+	skippedFile, err := os.Create(skippedPath)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to create file for skipped invoices: %v", err)
+	}
+	defer skippedFile.Close()
+
+	failedInvoicesWriter := newSkippedWriter(skippedFile, header)
+	defer failedInvoicesWriter.flush()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	currencyRates := options.CurrencyRates
+	if currencyRates == nil {
+		currencyRates = nbp.NewClient()
+	}
+
+	p := &processor{
+		ctx:              ctx,
+		cancel:           cancel,
+		api:              api,
+		apiId:            k360Client.ApiId(),
+		existingInvoices: existingInvoices,
+		taxRates:         rates,
+		currencyRates:    currencyRates,
+		mode:             options.Mode,
+		taxTolerance:     decimalFromFloat(options.TaxTolerance),
+		amounts:          options.Amounts,
+		ledger:           uploadLedger,
+		journal:          runJournal,
+		skipped:          failedInvoicesWriter,
+		progress:         newOrderedProgress(numberOfRecords, progressCallback),
+		taxpayerLoader:   taxpayer.NewBufferedTaxpayerDataLoader(),
+		createdCustomers: make(map[string]string),
+		locks:            newKeyedMutex(),
+	}
 
 	log.Println("start processing invoices without nip")
 
+	// credit notes are posted after all invoices, as the invoices they
+	// correct may be in the same report
+	creditNotes := make([]*invoiceRecords, 0)
+
+	pool := newWorkerPool(options.Workers)
+	cancelled := false
+	dispatch := func(group *invoiceRecords) {
+		if cancelled || ctx.Err() != nil {
+			cancelled = true
+			p.notAttempted(group)
+			p.finish(group)
+			return
+		}
+
+		if len(group.problems) != 0 {
+			log.Printf("skipping invalid invoice %v\n", group.no())
+			p.skipGroup(group, StageValidation, errors.New(strings.Join(group.problems, "; ")))
+			p.finish(group)
+			return
+		}
+
+		if group.first().DocType == DocCreditNote {
+			creditNotes = append(creditNotes, group)
+			p.finish(group)
+			return
+		}
+
+		pool.submit(func() {
+			p.processInvoice(group)
+			p.finish(group)
+		})
+	}
+	invoices := newGrouper(options.Grouping, options.Mode, dispatch)
+
 	currRecord := 0
 	for {
+		rawRecord, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			currRecord++
+			p.summary.Records++
+
+			log.Printf("failed to parse record: %v\n", err)
+			p.skip(rawRecord, StageValidation, parseErr.Err)
+			p.progress.done(currRecord, "")
+			continue
+		}
+		if err != nil {
+			pool.wait()
+			return p.summary, fmt.Errorf("failed to read record: %v", err)
+		}
 		currRecord++
+		p.summary.Records++
 
-		record, err := reader.Read()
+		line, _ := reader.FieldPos(0)
+		record, err := columns.record(rawRecord, line)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return fmt.Errorf("failed to read record: %v", err)
+			log.Printf("failed to read record: %v\n", err)
+			p.skip(rawRecord, StageValidation, err)
+			p.progress.done(currRecord, "")
+			continue
 		}
 
-		progressCallback(fmt.Sprintf("Invoice № %v", record[0]), numberOfRecords, currRecord)
+		invoices.add(record.normalized(options), currRecord, invalidLines[line])
+	}
+	invoices.flush()
+	pool.wait()
 
-		nip := record[2]
+	log.Println("end processing invoices without nip")
 
-		var customerId string
-		if nip != "" {
-			customerId, err = client.GetCustomerId(customer.Customer{Nip: nip})
-			if err != nil {
-				if errors.Is(err, customer.ErrNotFound) {
-					err = taxpayerLoader.LoadTaxpayerData(nip)
-					if err != nil {
-						log.Printf("failed to load taxpayer data with nip %v: %v\n", nip, err)
-					}
-
-					csvRecordsUnknownNipInvoices = append(csvRecordsUnknownNipInvoices, record)
-					continue
-				} else {
-					log.Printf("failed to get customer id with nip %v for invoice %v: %v\n", nip, record[0], err)
-					failedInvoicesWriter.Write(record)
-					continue
-				}
-			}
-		} else {
-			customerId = record[6]
+	if cancelled {
+		log.Println("processing cancelled, writing not attempted invoices to skipped invoices")
+		for _, group := range append(p.unknownNipInvoices, creditNotes...) {
+			p.notAttempted(group)
+		}
+		return p.summary, p.err()
+	}
+
+	if !p.processUnknownNips(options.Workers, &currRecord) {
+		for _, group := range creditNotes {
+			p.notAttempted(group)
 		}
+		return p.summary, p.err()
+	}
 
-		invoice := getInvoiceFromRecord(record, customerId)
+	if len(creditNotes) != 0 {
+		log.Println("start processing credit notes")
 
-		err = client.PostInvoice(invoice)
-		if err != nil {
-			log.Printf("failed to post invoice %v: %v\n", invoice, err)
-			failedInvoicesWriter.Write(record)
+		if p.runPhase(creditNotes, options.Workers, &currRecord, p.processInvoice) {
+			p.processUnknownNips(options.Workers, &currRecord)
 		}
+
+		log.Println("end processing credit notes")
 	}
 
-	log.Println("end processing invoices without nip")
+	return p.summary, p.err()
+}
 
-	err = taxpayerLoader.Flush()
+// processUnknownNips creates the customers of the invoices whose NIP wasn't
+// found from the White List data and posts the invoices. It returns false
+// when the run was cancelled.
+func (p *processor) processUnknownNips(workers int, currRecord *int) bool {
+	p.loaderMu.Lock()
+	err := p.taxpayerLoader.Flush(p.ctx)
+	p.loaderMu.Unlock()
 	if err != nil {
 		log.Println("failed to flush taxpayer loader:", err)
+		p.mu.Lock()
+		p.whiteListErr = err
+		p.mu.Unlock()
 	}
 
 	log.Println("start processing invoices with nip")
 
-	for _, record := range csvRecordsUnknownNipInvoices {
-		currRecord++
-		progressCallback(fmt.Sprintf("Invoice № %v", record[0]), numberOfRecords, currRecord)
+	groups := p.unknownNipInvoices
+	p.unknownNipInvoices = nil
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ordinals[0] < groups[j].ordinals[0]
+	})
 
-		if taxpayerLoader.RetrievedTaxpayers[record[2]] == nil {
-			log.Printf("failed to get taxpayer info with nip %v for invoice %v\n", record[2], record[0])
-			failedInvoicesWriter.Write(record)
-		} else {
-			taxpayer := taxpayerLoader.RetrievedTaxpayers[record[2]]
-
-			newCustomer := customer.Customer{
-				Name:        taxpayer.Name,
-				Nip:         taxpayer.Nip,
-				CountryCode: taxpayer.Address.CountryCode,
-				Regon:       taxpayer.Regon,
-				Street:      taxpayer.Address.Street,
-				PostalCode:  taxpayer.Address.PostalCode,
-				City:        taxpayer.Address.City,
-				County:      taxpayer.Address.Country,
-			}
+	ok := p.runPhase(groups, workers, currRecord, p.processUnknownNipInvoice)
 
-			customerId, err := client.PostCustomer(newCustomer)
-			if err != nil {
-				log.Printf("failed to post customer %v for invoice %v: %v", newCustomer, record[0], err)
-				failedInvoicesWriter.Write(record)
-				continue
+	log.Println("end processing invoices with nip")
+	return ok
+}
+
+// runPhase processes the invoices on a new worker pool, numbering their
+// records after the earlier phases for progress reporting. It returns false
+// when the run was cancelled, invoices which weren't attempted are skipped
+// then.
+func (p *processor) runPhase(groups []*invoiceRecords, workers int, currRecord *int, process func(group *invoiceRecords)) bool {
+	pool := newWorkerPool(workers)
+	for i, group := range groups {
+		if p.ctx.Err() != nil {
+			pool.wait()
+
+			log.Println("processing cancelled, writing not attempted invoices to skipped invoices")
+			for _, group := range groups[i:] {
+				p.notAttempted(group)
 			}
+			return false
+		}
+
+		for j := range group.ordinals {
+			*currRecord++
+			group.ordinals[j] = *currRecord
+		}
+
+		group := group
+		pool.submit(func() {
+			process(group)
+			p.finish(group)
+		})
+	}
+	pool.wait()
+
+	return true
+}
+
+// processor holds the state of a single ProcessInvoices run shared by its
+// workers. Everything except the api calls and the taxpayer loader is
+// guarded by mu.
+type processor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	api    k360Api
+	apiId  string
+
+	existingInvoices map[string]bool
+	taxRates         taxRates
+	currencyRates    nbp.Provider
+	mode             Mode
+	taxTolerance     invoice.Decimal
+	amounts          Amounts
+	progress         *orderedProgress
+	locks            *keyedMutex
+
+	// loaderMu guards taxpayerLoader separately from mu as loading can
+	// send a White List request, which must not block the other workers.
+	loaderMu       sync.Mutex
+	taxpayerLoader *taxpayer.BufferedTaxpayerDataLoader
+
+	mu                 sync.Mutex
+	summary            Summary
+	ledger             *ledger
+	journal            *journal
+	skipped            *skippedWriter
+	unknownNipInvoices []*invoiceRecords
+	createdCustomers   map[string]string
+	whiteListErr       error
+	abortErr           error
+}
+
+func (p *processor) skip(record []string, stage Stage, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.skipped.write(record, stage, err)
+	p.summary.Skipped++
+}
+
+func (p *processor) skipGroup(group *invoiceRecords, stage Stage, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range group.records {
+		p.skipped.write(record.Raw, stage, err)
+	}
+	p.summary.Skipped += len(group.records)
+}
+
+// finish reports progress of all records of the invoice.
+func (p *processor) finish(group *invoiceRecords) {
+	last := len(group.ordinals) - 1
+	for _, ordinal := range group.ordinals[:last] {
+		p.progress.done(ordinal, "")
+	}
+	p.progress.done(group.ordinals[last], fmt.Sprintf("Invoice № %v", group.no()))
+}
+
+func (p *processor) journalOutcome(group *invoiceRecords, outcome string) {
+	if err := p.journal.record(p.ledgerNo(group), outcome); err != nil {
+		log.Printf("failed to record invoice %v in journal: %v\n", group.no(), err)
+	}
+}
+
+// notAttempted skips an invoice which wasn't sent because the run was
+// cancelled or aborted.
+func (p *processor) notAttempted(group *invoiceRecords) {
+	p.mu.Lock()
+	reason := errProcessingCancelled
+	if p.abortErr != nil {
+		reason = fmt.Errorf("processing aborted: %v", p.abortErr)
+	}
+	p.mu.Unlock()
+
+	p.skipGroup(group, StageNotAttempted, reason)
+}
+
+// fail skips an invoice which couldn't be uploaded. Errors caused by bad
+// credentials abort the whole run as no other invoice would succeed.
+func (p *processor) fail(group *invoiceRecords, stage Stage, err error) {
+	p.skipGroup(group, stage, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.journalOutcome(group, outcomeSkipped)
+
+	if client.IsAuthError(err) && p.abortErr == nil {
+		log.Printf("aborting processing, invoice %v was rejected: %v\n", group.no(), err)
+		p.abortErr = err
+		p.cancel()
+	}
+}
+
+// err returns the reason the run was stopped, if it was.
+func (p *processor) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.abortErr != nil {
+		return p.abortErr
+	}
+	return p.ctx.Err()
+}
+
+func (p *processor) isDone(group *invoiceRecords) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	no := group.no()
+	if p.journal.completed(p.ledgerNo(group)) {
+		log.Printf("skipping invoice %v: already completed in a previous run of this report\n", no)
+		p.summary.Resumed++
+		return true
+	}
+
+	if p.existingInvoices[no] || p.ledger.contains(p.apiId, p.ledgerNo(group)) {
+		log.Printf("skipping invoice %v: duplicate, it was already posted\n", no)
+		p.summary.Duplicates++
+		p.journalOutcome(group, outcomeDuplicate)
+		return true
+	}
+
+	return false
+}
 
-			invoice := getInvoiceFromRecord(record, customerId)
+func (p *processor) postInvoice(group *invoiceRecords, customerId string) {
+	invoice := getInvoiceFromRecords(group.records, group.lines, customerId)
+	if group.rate != nil {
+		invoice.CurrencyCode = group.rate.Currency
+		invoice.CurrencyRate = &group.rate.Mid
+
+		net, tax := invoice.AmountsInPLN()
+		log.Printf("invoice %v in %v at NBP rate %v of %v (table %v): net %v PLN, tax %v PLN\n", invoice.No, group.rate.Currency, group.rate.Mid, group.rate.Date.Format("2006-01-02"), group.rate.Table, net, tax)
+	}
+
+	var err error
+	if record := group.first(); p.mode == ModePurchase {
+		err = p.api.PostPurchaseInvoice(p.ctx, invoice.PurchaseInvoice(customerId))
+	} else if record.DocType == DocCreditNote {
+		err = p.api.PostCreditNote(p.ctx, invoice.CreditNote(record.OriginalNo, record.OriginalDate, record.CorrectionReason))
+	} else {
+		err = p.api.PostInvoice(p.ctx, invoice)
+	}
+	if err != nil {
+		log.Printf("failed to post invoice %v: %v\n", invoice, err)
+		p.fail(group, StageInvoicePost, err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.ledger.add(p.apiId, p.ledgerNo(group)); err != nil {
+		log.Printf("failed to add invoice %v to upload ledger: %v\n", group.no(), err)
+	}
+	p.journalOutcome(group, outcomePosted)
+}
+
+func (p *processor) processInvoice(group *invoiceRecords) {
+	if p.ctx.Err() != nil {
+		p.notAttempted(group)
+		return
+	}
+
+	unlock := p.locks.lock("invoice:" + p.ledgerNo(group))
+	defer unlock()
+
+	if p.isDone(group) {
+		return
+	}
+
+	lines, err := invoiceLines(group.records, p.amounts, p.taxRates)
+	if err == nil && p.amounts == AmountsNet {
+		err = checkTaxes(group.records, lines, p.taxRates, p.taxTolerance)
+	}
+	if err != nil {
+		log.Printf("failed tax check of invoice %v: %v\n", group.no(), err)
+		p.fail(group, StageTaxCheck, err)
+		return
+	}
+	group.lines = lines
+
+	group.rate, err = p.exchangeRate(group)
+	if err != nil {
+		log.Printf("failed to get exchange rate of invoice %v: %v\n", group.no(), err)
+		p.fail(group, StageExchangeRate, err)
+		return
+	}
+
+	record := group.first()
+	nip := record.CustomerNip
+	if nip == "" {
+		p.postInvoice(group, record.CustomerId)
+		return
+	}
+
+	customerId, err := p.lookupParty(nip)
+	if err != nil {
+		if isPartyNotFound(err) {
+			p.loaderMu.Lock()
+			err = p.taxpayerLoader.LoadTaxpayerData(p.ctx, nip)
+			p.loaderMu.Unlock()
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
 
-			err = client.PostInvoice(invoice)
 			if err != nil {
-				log.Printf("failed to post invoice %v: %v\n", invoice, err)
-				failedInvoicesWriter.Write(record)
+				log.Printf("failed to load taxpayer data with nip %v: %v\n", nip, err)
+				p.whiteListErr = err
 			}
+
+			p.unknownNipInvoices = append(p.unknownNipInvoices, group)
+		} else {
+			log.Printf("failed to get customer id with nip %v for invoice %v: %v\n", nip, record.No, err)
+			p.fail(group, StageCustomerLookup, err)
 		}
+		return
 	}
 
-	log.Println("end processing invoices with nip")
+	p.postInvoice(group, customerId)
+}
+
+func (p *processor) processUnknownNipInvoice(group *invoiceRecords) {
+	if p.ctx.Err() != nil {
+		p.notAttempted(group)
+		return
+	}
+
+	unlockInvoice := p.locks.lock("invoice:" + p.ledgerNo(group))
+	defer unlockInvoice()
+
+	if p.isDone(group) {
+		return
+	}
+
+	record := group.first()
+
+	unlockNip := p.locks.lock("nip:" + record.CustomerNip)
+	defer unlockNip()
+
+	p.loaderMu.Lock()
+	taxpayer := p.taxpayerLoader.RetrievedTaxpayers[record.CustomerNip]
+	p.loaderMu.Unlock()
+
+	p.mu.Lock()
+	customerId, created := p.createdCustomers[record.CustomerNip]
+	whiteListErr := p.whiteListErr
+	p.mu.Unlock()
+
+	if !created {
+		if taxpayer == nil {
+			log.Printf("failed to get taxpayer info with nip %v for invoice %v\n", record.CustomerNip, record.No)
+			err := fmt.Errorf("taxpayer with nip %v not found in the White List", record.CustomerNip)
+			if whiteListErr != nil {
+				err = fmt.Errorf("taxpayer with nip %v not loaded from the White List: %v", record.CustomerNip, whiteListErr)
+			}
+			p.fail(group, StageWhiteListLookup, err)
+			return
+		}
+
+		var err error
+		customerId, err = p.createParty(taxpayer)
+		if err != nil {
+			log.Printf("failed to post customer with nip %v for invoice %v: %v", record.CustomerNip, record.No, err)
+			p.fail(group, StageCustomerCreate, err)
+			return
+		}
+
+		p.mu.Lock()
+		p.createdCustomers[record.CustomerNip] = customerId
+		p.mu.Unlock()
+	}
 
-	return nil
+	p.postInvoice(group, customerId)
 }
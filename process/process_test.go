@@ -0,0 +1,482 @@
+package process
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mrsydar/tkl/k360/client"
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/k360test"
+	"mrsydar/tkl/taxpayer"
+)
+
+const testHeader = "no,date,customer_nip,net,tax,tax_id,customer_id,product_code,product_description"
+
+func setupTest(t *testing.T) (client.K360Client, *k360test.Server) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	server := k360test.NewServer("test-id", "test-key")
+	t.Cleanup(server.Close)
+
+	return *client.New("test-id", "test-key", client.WithBaseURL(server.URL), client.WithRateLimit(0)), server
+}
+
+func setupWhiteList(t *testing.T, workingAddresses map[string]string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nips := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/search/nips/"), ",")
+
+		entries := make([]interface{}, 0)
+		for _, nip := range nips {
+			if address, ok := workingAddresses[nip]; ok {
+				entries = append(entries, map[string]interface{}{
+					"subjects": []interface{}{
+						map[string]interface{}{
+							"name":           "TAXPAYER " + nip,
+							"nip":            nip,
+							"regon":          "367435452",
+							"workingAddress": address,
+						},
+					},
+				})
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"entries": entries},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	previousURL := taxpayer.WhiteListURL
+	taxpayer.WhiteListURL = server.URL
+	t.Cleanup(func() { taxpayer.WhiteListURL = previousURL })
+}
+
+func writeReport(t *testing.T, lines ...string) string {
+	return writeReportWithHeader(t, testHeader, lines...)
+}
+
+func writeReportWithHeader(t *testing.T, header string, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	content := header + "\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readSkipped(t *testing.T) [][]string {
+	file, err := os.Open("skipped_invoices.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records[1:]
+}
+
+func noProgress(message string, recordsNumber, currentRecord int) {}
+
+func TestProcessInvoicesKnownCustomers(t *testing.T) {
+	k360, server := setupTest(t)
+	knownId := server.AddCustomer(customer.Customer{Name: "KNOWN", Nip: "7792465289"})
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 2 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 2 {
+		t.Fatalf("expected 2 invoices, but got %v", len(invoices))
+	}
+
+	if invoices[0].No != "FV/1" || invoices[0].Customer.Id != knownId {
+		t.Fatalf("unexpected first invoice: %+v", invoices[0])
+	}
+
+	if invoices[1].No != "FV/2" || invoices[1].Customer.Id != walkInId {
+		t.Fatalf("unexpected second invoice: %+v", invoices[1])
+	}
+
+	if invoices[1].TotalAmount.String() != "54.00" || invoices[1].TaxAmounts[0].Amount.String() != "4.00" || invoices[1].DocDate != "20220531130000" {
+		t.Fatalf("unexpected second invoice amounts: %+v", invoices[1])
+	}
+}
+
+func TestProcessInvoicesCreatesCustomerFromWhiteList(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{"7792465289": "SZAMOTULSKA 40/1A, 60-366 POZNAŃ"})
+
+	report := writeReport(t, "FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1")
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	customers := server.Customers()
+	if len(customers) != 1 {
+		t.Fatalf("expected 1 customer, but got %v", len(customers))
+	}
+
+	expected := customer.Customer{
+		Id:          customers[0].Id,
+		Name:        "TAXPAYER 7792465289",
+		Nip:         "7792465289",
+		CountryCode: "PL",
+		Regon:       "367435452",
+		Street:      "SZAMOTULSKA 40/1A",
+		PostalCode:  "60-366",
+		City:        "POZNAŃ",
+		County:      "POLSKA",
+	}
+	if customers[0] != expected {
+		t.Fatalf("expected customer %+v, but got %+v", expected, customers[0])
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 1 || invoices[0].Customer.Id != customers[0].Id {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestProcessInvoicesConcurrentWorkers(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{"7792465289": "SZAMOTULSKA 40/1A, 60-366 POZNAŃ"})
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,7792465289,10.00,0.80,tax-8,,P3,Product 3",
+		"FV/4,20220531150000,,10.00,0.80,tax-8,"+walkInId+",P4,Product 4",
+		"FV/5,20220531160000,,10.00,0.80,tax-8,"+walkInId+",P5,Product 5",
+		"FV/6,20220531170000,7792465289,10.00,0.80,tax-8,,P6,Product 6",
+	)
+
+	var progress []int
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{Workers: 4}, func(message string, recordsNumber, currentRecord int) {
+		progress = append(progress, currentRecord)
+	})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 6 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if customers := server.Customers(); len(customers) != 2 {
+		t.Fatalf("expected customer to be created once, but got customers: %+v", customers)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 6 {
+		t.Fatalf("expected 6 invoices, but got %v", len(invoices))
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("progress reported out of order: %v", progress)
+		}
+	}
+}
+
+func TestProcessInvoicesDefaults(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	otherId := server.AddCustomer(customer.Customer{Name: "OTHER"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,,,P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+otherId+",P2,Product 2",
+	)
+
+	options := Options{DefaultTaxId: "tax-23", DefaultCustomerId: walkInId}
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 2 {
+		t.Fatalf("expected 2 invoices, but got %+v", invoices)
+	}
+	if invoices[0].Customer.Id != walkInId || invoices[0].Rows[0].TaxId != "tax-23" {
+		t.Fatalf("expected defaults to be used, but got %+v", invoices[0])
+	}
+	if invoices[1].Customer.Id != otherId || invoices[1].Rows[0].TaxId != "tax-8" {
+		t.Fatalf("expected report values to be kept, but got %+v", invoices[1])
+	}
+}
+
+func TestProcessInvoicesSkipsFailures(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{})
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	server.RejectInvoice("FV/2", "bad invoice")
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,5260250995,10.00,0.80,tax-8,,P3,Product 3",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	skipped := readSkipped(t)
+	if len(skipped) != 2 || skipped[0][0] != "FV/2" || skipped[1][0] != "FV/3" {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if stage, status := skipped[0][9], skipped[0][11]; stage != string(StageInvoicePost) || status != "400" || !strings.Contains(skipped[0][10], "bad invoice") {
+		t.Fatalf("unexpected skip reason: %v", skipped[0])
+	}
+
+	if stage, status := skipped[1][9], skipped[1][11]; stage != string(StageWhiteListLookup) || status != "" {
+		t.Fatalf("unexpected skip reason: %v", skipped[1])
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 1 || invoices[0].No != "FV/1" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestProcessInvoicesReimportSkipped(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	server.RejectInvoice("FV/2", "bad invoice")
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+	)
+
+	if _, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	data, err := os.ReadFile(SkippedInvoicesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reimported := filepath.Join(t.TempDir(), "reimported.csv")
+	if err := os.WriteFile(reimported, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, reimported, Options{}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 1 || summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	file, err := os.Open(SkippedInvoicesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testHeader + ",skip_stage,skip_error,skip_http_status"
+	if strings.Join(header, ",") != expected {
+		t.Fatalf("expected header %q, but got %q", expected, strings.Join(header, ","))
+	}
+}
+
+func TestProcessInvoicesBadCredentials(t *testing.T) {
+	_, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+	k360 := *client.New("test-id", "wrong-key", client.WithBaseURL(server.URL))
+
+	report := writeReport(t, "FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1")
+
+	_, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err == nil {
+		t.Fatalf("error was expected")
+	}
+
+	if len(server.Invoices()) != 0 {
+		t.Fatalf("nothing should be posted with bad credentials")
+	}
+}
+
+func TestProcessInvoicesAbortsOnAuthError(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{}, func(message string, recordsNumber, currentRecord int) {
+		if currentRecord == 1 {
+			server.FailRequests(1, http.StatusUnauthorized, "")
+		}
+	})
+	if !client.IsAuthError(err) {
+		t.Fatalf("expected auth error, but got %v", err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	skipped := readSkipped(t)
+	if len(skipped) != 2 || skipped[0][9] != string(StageInvoicePost) || skipped[1][9] != string(StageNotAttempted) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 1 || invoices[0].No != "FV/1" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestProcessInvoicesCancelled(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	summary, err := ProcessInvoices(ctx, k360, report, Options{}, func(message string, recordsNumber, currentRecord int) {
+		if currentRecord == 1 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, but got %v", context.Canceled, err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	skipped := readSkipped(t)
+	if len(skipped) != 2 || skipped[0][0] != "FV/2" || skipped[1][0] != "FV/3" {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 1 || invoices[0].No != "FV/1" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestProcessInvoicesColumnMapping(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReportWithHeader(t,
+		"Opis,Kod,Klient,NIP,Stawka,VAT,Netto,Data,Numer",
+		"Product 1,P1,"+walkInId+",,tax-23,23.00,100.00,20220531120000,FV/1",
+		"Product 2,P2,"+walkInId,
+	)
+
+	options := Options{
+		Columns: ColumnMapping{
+			ColumnNo:                 "Numer",
+			ColumnDate:               "Data",
+			ColumnCustomerNip:        "NIP",
+			ColumnNet:                "Netto",
+			ColumnTax:                "VAT",
+			ColumnTaxId:              "Stawka",
+			ColumnCustomerId:         "Klient",
+			ColumnProductCode:        "Kod",
+			ColumnProductDescription: "Opis",
+		},
+		IgnoreValidationErrors: true,
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 2 || summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 1 {
+		t.Fatalf("expected 1 invoice, but got %v", len(invoices))
+	}
+
+	if invoices[0].No != "FV/1" || invoices[0].TotalAmount.String() != "123.00" || invoices[0].Rows[0].Item.Code != "P1" {
+		t.Fatalf("unexpected invoice: %+v", invoices[0])
+	}
+}
+
+func TestProcessInvoicesMissingColumn(t *testing.T) {
+	k360, _ := setupTest(t)
+
+	report := writeReportWithHeader(t, "no,date,customer_nip,net,tax,tax_id,customer_id,product_code")
+
+	_, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+	if err == nil || !strings.Contains(err.Error(), `"product_description"`) {
+		t.Fatalf("expected missing column error, but got %v", err)
+	}
+
+	if _, err := os.Stat("skipped_invoices.csv"); !os.IsNotExist(err) {
+		t.Fatalf("skipped invoices file should not be created")
+	}
+}
@@ -0,0 +1,97 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/vendor"
+	"mrsydar/tkl/taxpayer"
+)
+
+// Mode decides whether the report has sales or purchase invoices.
+type Mode int
+
+const (
+	// ModeSales uploads sales invoices, customer_nip and customer_id are
+	// the customer's.
+	ModeSales Mode = iota
+	// ModePurchase uploads purchase invoices received from vendors,
+	// customer_nip and customer_id are the vendor's and no is the vendor's
+	// invoice number.
+	ModePurchase
+)
+
+func ParseMode(value string) (Mode, error) {
+	switch value {
+	case "", "sales":
+		return ModeSales, nil
+	case "purchase":
+		return ModePurchase, nil
+	}
+	return ModeSales, fmt.Errorf("unknown mode %q, expected sales or purchase", value)
+}
+
+func isPartyNotFound(err error) bool {
+	return errors.Is(err, customer.ErrNotFound) || errors.Is(err, vendor.ErrNotFound)
+}
+
+// lookupParty returns the id of the customer or, in purchase mode, the
+// vendor with the NIP.
+func (p *processor) lookupParty(nip string) (string, error) {
+	if p.mode == ModePurchase {
+		return p.api.GetVendorId(p.ctx, vendor.Vendor{Nip: nip})
+	}
+	return p.api.GetCustomerId(p.ctx, customer.Customer{Nip: nip})
+}
+
+// createParty creates the customer or, in purchase mode, the vendor from
+// the White List data.
+func (p *processor) createParty(taxpayer *taxpayer.Taxpayer) (string, error) {
+	if p.mode == ModePurchase {
+		newVendor := vendor.Vendor{
+			Name:        taxpayer.Name,
+			Nip:         taxpayer.Nip,
+			CountryCode: taxpayer.Address.CountryCode,
+			Regon:       taxpayer.Regon,
+			Street:      taxpayer.Address.Street,
+			PostalCode:  taxpayer.Address.PostalCode,
+			City:        taxpayer.Address.City,
+			County:      taxpayer.Address.Country,
+		}
+		return p.api.PostVendor(p.ctx, newVendor)
+	}
+
+	newCustomer := customer.Customer{
+		Name:        taxpayer.Name,
+		Nip:         taxpayer.Nip,
+		CountryCode: taxpayer.Address.CountryCode,
+		Regon:       taxpayer.Regon,
+		Street:      taxpayer.Address.Street,
+		PostalCode:  taxpayer.Address.PostalCode,
+		City:        taxpayer.Address.City,
+		County:      taxpayer.Address.Country,
+	}
+	return p.api.PostCustomer(p.ctx, newCustomer)
+}
+
+// invoiceKey identifies the invoice of the record in the report. Numbers of
+// purchase invoices are given by vendors, so they are only unique together
+// with the vendor.
+func (record Record) invoiceKey(mode Mode) string {
+	if mode != ModePurchase {
+		return record.No
+	}
+
+	vendorKey := record.CustomerNip
+	if vendorKey == "" {
+		vendorKey = record.CustomerId
+	}
+	return "purchase:" + vendorKey + ":" + record.No
+}
+
+// ledgerNo returns the key of the invoice in the upload ledger, the run
+// journal and the invoice locks.
+func (p *processor) ledgerNo(group *invoiceRecords) string {
+	return group.first().invoiceKey(p.mode)
+}
@@ -0,0 +1,150 @@
+package process
+
+import (
+	"context"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/vendor"
+)
+
+func TestProcessInvoicesPurchase(t *testing.T) {
+	k360, server := setupTest(t)
+	setupWhiteList(t, map[string]string{"5260250995": "SZAMOTULSKA 40/1A, 60-366 POZNAŃ"})
+	knownId := server.AddVendor(vendor.Vendor{Name: "KNOWN", Nip: "7792465289"})
+	server.AddCustomer(customer.Customer{Name: "CUSTOMER", Nip: "5260250995"})
+
+	report := writeReport(t,
+		"1/05/2022,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"FZ/7,20220531130000,5260250995,10.00,0.80,tax-8,,P2,Product 2",
+	)
+
+	options := Options{Mode: ModePurchase, TaxTolerance: DefaultTaxTolerance}
+	if problems, err := ValidateReport(report, options); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 2 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if len(server.Invoices()) != 0 || len(server.Customers()) != 1 {
+		t.Fatalf("sales invoices or customers should not be sent in purchase mode")
+	}
+
+	vendors := server.Vendors()
+	if len(vendors) != 2 || vendors[1].Nip != "5260250995" || vendors[1].City != "POZNAŃ" {
+		t.Fatalf("unexpected vendors: %+v", vendors)
+	}
+
+	purchaseInvoices := server.PurchaseInvoices()
+	if len(purchaseInvoices) != 2 {
+		t.Fatalf("unexpected purchase invoices: %+v", purchaseInvoices)
+	}
+	if purchaseInvoices[0].No != "1/05/2022" || purchaseInvoices[0].Vendor.Id != knownId || purchaseInvoices[0].TotalAmount.String() != "123.00" {
+		t.Fatalf("unexpected purchase invoice: %+v", purchaseInvoices[0])
+	}
+	if purchaseInvoices[1].No != "FZ/7" || purchaseInvoices[1].Vendor.Id != vendors[1].Id {
+		t.Fatalf("unexpected purchase invoice: %+v", purchaseInvoices[1])
+	}
+}
+
+func TestProcessInvoicesPurchaseSameNumberFromVendors(t *testing.T) {
+	k360, server := setupTest(t)
+	server.AddVendor(vendor.Vendor{Name: "FIRST", Nip: "7792465289"})
+	server.AddVendor(vendor.Vendor{Name: "SECOND", Nip: "5260250995"})
+
+	options := Options{Mode: ModePurchase, TaxTolerance: DefaultTaxTolerance}
+
+	first := writeReport(t, "1/05/2022,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1")
+	if _, err := ProcessInvoices(context.Background(), k360, first, options, noProgress); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	second := writeReport(t, "1/05/2022,20220531130000,5260250995,10.00,0.80,tax-8,,P2,Product 2")
+	summary, err := ProcessInvoices(context.Background(), k360, second, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Duplicates != 0 || len(server.PurchaseInvoices()) != 2 {
+		t.Fatalf("invoice with the same number from another vendor is not a duplicate: %+v", summary)
+	}
+
+	summary, err = ProcessInvoices(context.Background(), k360, second, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Duplicates+summary.Resumed != 1 || len(server.PurchaseInvoices()) != 2 {
+		t.Fatalf("unexpected summary of the repeated run: %+v", summary)
+	}
+}
+
+func TestProcessInvoicesPurchaseSameNumberInReport(t *testing.T) {
+	k360, server := setupTest(t)
+	server.AddVendor(vendor.Vendor{Name: "FIRST", Nip: "7792465289"})
+	server.AddVendor(vendor.Vendor{Name: "SECOND", Nip: "5260250995"})
+
+	report := writeReport(t,
+		"1/05/2022,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"1/05/2022,20220531120000,7792465289,50.00,11.50,tax-23,,P3,Product 3",
+		"1/05/2022,20220531130000,5260250995,10.00,0.80,tax-8,,P2,Product 2",
+	)
+
+	for _, grouping := range []Grouping{GroupConsecutive, GroupAll} {
+		options := Options{Mode: ModePurchase, Grouping: grouping, TaxTolerance: DefaultTaxTolerance}
+		if problems, err := ValidateReport(report, options); err != nil || len(problems) != 0 {
+			t.Fatalf("unexpected validation result with grouping %v: %v, %v", grouping, problems, err)
+		}
+	}
+
+	options := Options{Mode: ModePurchase, Grouping: GroupAll, TaxTolerance: DefaultTaxTolerance, Workers: 4}
+	summary, err := ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 0 || summary.Duplicates != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	purchaseInvoices := server.PurchaseInvoices()
+	if len(purchaseInvoices) != 2 {
+		t.Fatalf("unexpected purchase invoices: %+v", purchaseInvoices)
+	}
+	for _, purchaseInvoice := range purchaseInvoices {
+		if purchaseInvoice.DocDate == "20220531120000" && (len(purchaseInvoice.Rows) != 2 || purchaseInvoice.TotalAmount.String() != "184.50") {
+			t.Fatalf("unexpected purchase invoice of the first vendor: %+v", purchaseInvoice)
+		}
+	}
+
+	summary, err = ProcessInvoices(context.Background(), k360, report, options, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Resumed != 2 || len(server.PurchaseInvoices()) != 2 {
+		t.Fatalf("unexpected summary of the repeated run: %+v", summary)
+	}
+}
+
+func TestValidateReportPurchaseCreditNote(t *testing.T) {
+	report := writeReportWithHeader(t, creditNoteHeader,
+		"KOR/1,20220531120000,,-20.00,-4.60,tax-23,v,P1,Product 1,credit_note,FV/1,2022-05-10,price reduction",
+	)
+
+	problems, err := ValidateReport(report, Options{Mode: ModePurchase})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if len(problems) != 1 || problems[0].Column != ColumnDocType {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
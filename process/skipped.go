@@ -0,0 +1,90 @@
+package process
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+
+	"mrsydar/tkl/k360/client"
+)
+
+type Stage string
+
+const (
+	StageValidation      Stage = "validation"
+	StageTaxCheck        Stage = "tax check"
+	StageCustomerLookup  Stage = "customer lookup"
+	StageWhiteListLookup Stage = "white list lookup"
+	StageCustomerCreate  Stage = "customer creation"
+	StageExchangeRate    Stage = "exchange rate"
+	StageInvoicePost     Stage = "invoice post"
+	StageNotAttempted    Stage = "not attempted"
+)
+
+const (
+	ColumnSkipStage      = "skip_stage"
+	ColumnSkipError      = "skip_error"
+	ColumnSkipHttpStatus = "skip_http_status"
+)
+
+var skipColumns = []string{ColumnSkipStage, ColumnSkipError, ColumnSkipHttpStatus}
+
+// skippedWriter writes skipped records together with the reason they were
+// skipped. Reason columns of a re-imported skipped invoices file are
+// dropped, so the output always has exactly one set of them.
+type skippedWriter struct {
+	writer  *csv.Writer
+	columns []int
+}
+
+func newSkippedWriter(w io.Writer, header []string) *skippedWriter {
+	columns := make([]int, 0, len(header))
+	for i, name := range header {
+		if !isSkipColumn(name) {
+			columns = append(columns, i)
+		}
+	}
+
+	sw := &skippedWriter{csv.NewWriter(w), columns}
+
+	sw.writer.Write(append(sw.original(header), skipColumns...))
+	return sw
+}
+
+func isSkipColumn(name string) bool {
+	for _, column := range skipColumns {
+		if normalizeHeaderName(name) == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (sw *skippedWriter) original(record []string) []string {
+	fields := make([]string, len(sw.columns))
+	for i, column := range sw.columns {
+		if column < len(record) {
+			fields[i] = record[column]
+		}
+	}
+	return fields
+}
+
+func (sw *skippedWriter) write(record []string, stage Stage, err error) {
+	message, status := "", ""
+	if err != nil {
+		message = err.Error()
+
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) {
+			status = strconv.Itoa(apiErr.StatusCode)
+		}
+	}
+
+	sw.writer.Write(append(sw.original(record), string(stage), message, status))
+}
+
+func (sw *skippedWriter) flush() {
+	sw.writer.Flush()
+}
@@ -0,0 +1,107 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mrsydar/tkl/k360/invoice"
+)
+
+// taxRates maps Księgowość360 tax ids to their VAT rates in percent. It's
+// nil when the rates aren't known, e.g. in a dry run without lookups.
+type taxRates map[string]invoice.Decimal
+
+func loadTaxRates(ctx context.Context, api k360Api) (taxRates, error) {
+	taxes, err := api.GetTaxes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax rates: %v", err)
+	}
+	if taxes == nil {
+		return nil, nil
+	}
+
+	rates := make(taxRates, len(taxes))
+	for _, tax := range taxes {
+		rates[tax.Id] = decimalFromFloat(tax.Pct)
+	}
+	return rates, nil
+}
+
+func decimalFromFloat(value float64) invoice.Decimal {
+	decimal, _ := invoice.ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+	return decimal
+}
+
+// parseVatRate parses VAT rates like 23, 8%, 0 or zw (exempt) from the
+// vat_rate column.
+func parseVatRate(value string) (invoice.Decimal, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "zw" || value == "np" {
+		return invoice.Decimal{}, nil
+	}
+
+	rate, err := invoice.ParseAmount(strings.TrimSuffix(value, "%"))
+	if err != nil || rate.Sign() < 0 || rate.Cmp(invoice.NewDecimal(100)) > 0 {
+		return invoice.Decimal{}, fmt.Errorf("%q is not a VAT rate like 23, 8%%, 0 or zw", value)
+	}
+	return rate, nil
+}
+
+// vatRate returns the rate of the record from the vat_rate column or from
+// its tax id. ok is false when the rate isn't known.
+func (rates taxRates) vatRate(record Record) (rate invoice.Decimal, ok bool, err error) {
+	if record.VatRate != "" {
+		rate, err := parseVatRate(record.VatRate)
+		return rate, err == nil, err
+	}
+
+	if rates == nil {
+		return invoice.Decimal{}, false, nil
+	}
+
+	rate, ok = rates[record.TaxId]
+	if !ok {
+		return invoice.Decimal{}, false, fmt.Errorf("tax id %q not found in Księgowość360", record.TaxId)
+	}
+	return rate, true, nil
+}
+
+// checkTaxes compares taxes of every tax id of the invoice with taxes
+// calculated from the net values and VAT rates. Rows rounded separately may
+// differ a bit from the calculated total, differences up to tolerance are
+// accepted.
+func checkTaxes(records []Record, lines []invoice.Line, rates taxRates, tolerance invoice.Decimal) error {
+	hundred := invoice.NewDecimal(100)
+
+	taxIds := make([]string, 0)
+	calculated := make(map[string]invoice.Decimal)
+	reported := make(map[string]invoice.Decimal)
+
+	for i, record := range records {
+		rate, ok, err := rates.vatRate(record)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if _, ok := calculated[record.TaxId]; !ok {
+			taxIds = append(taxIds, record.TaxId)
+		}
+		calculated[record.TaxId] = calculated[record.TaxId].Add(lines[i].Net.Mul(rate).Div(hundred))
+		reported[record.TaxId] = reported[record.TaxId].Add(lines[i].Tax)
+	}
+
+	for _, taxId := range taxIds {
+		expected := calculated[taxId].Round(invoice.AmountPlaces)
+		difference := reported[taxId].Sub(expected)
+		if difference.Abs().Cmp(tolerance) > 0 {
+			return fmt.Errorf("tax %v of tax id %q differs from calculated %v by %v", reported[taxId], taxId, expected, difference)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package process
+
+import (
+	"context"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+	"mrsydar/tkl/k360/invoice"
+)
+
+func TestCheckTaxes(t *testing.T) {
+	rates := taxRates{
+		"tax-23": invoice.NewDecimal(23),
+		"tax-8":  invoice.NewDecimal(8),
+		"tax-zw": invoice.NewDecimal(0),
+	}
+	tolerance := decimal(t, "0.01")
+
+	tests := []struct {
+		name    string
+		records []Record
+		rates   taxRates
+		valid   bool
+	}{
+		{"exact", []Record{
+			{Net: "100.00", Tax: "23.00", TaxId: "tax-23"},
+			{Net: "50.00", Tax: "4.00", TaxId: "tax-8"},
+		}, rates, true},
+		{"rounded rows", []Record{
+			{Net: "0.05", Tax: "0.01", TaxId: "tax-23"},
+			{Net: "0.05", Tax: "0.01", TaxId: "tax-23"},
+		}, rates, true},
+		{"too big difference", []Record{
+			{Net: "100.00", Tax: "23.00", TaxId: "tax-23"},
+			{Net: "50.00", Tax: "11.50", TaxId: "tax-8"},
+		}, rates, false},
+		{"exempt with tax", []Record{
+			{Net: "100.00", Tax: "1.00", TaxId: "tax-zw"},
+		}, rates, false},
+		{"unknown tax id", []Record{
+			{Net: "100.00", Tax: "23.00", TaxId: "tax-7"},
+		}, rates, false},
+		{"rate from report", []Record{
+			{Net: "100.00", Tax: "5.00", TaxId: "tax-7", VatRate: "5%"},
+		}, rates, true},
+		{"rates unknown", []Record{
+			{Net: "100.00", Tax: "1.00", TaxId: "tax-23"},
+		}, nil, true},
+	}
+
+	for _, test := range tests {
+		lines, err := invoiceLines(test.records, AmountsNet, test.rates)
+		if err != nil {
+			t.Fatalf("%v: error was not expected: %v", test.name, err)
+		}
+
+		err = checkTaxes(test.records, lines, test.rates, tolerance)
+		if (err == nil) != test.valid {
+			t.Errorf("%v: unexpected result: %v", test.name, err)
+		}
+	}
+}
+
+func TestParseVatRate(t *testing.T) {
+	tests := map[string]string{
+		"23":  "23",
+		"8%":  "8",
+		"zw":  "0",
+		"ZW":  "0",
+		"0":   "0",
+		"-1":  "",
+		"abc": "",
+	}
+
+	for value, expected := range tests {
+		rate, err := parseVatRate(value)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q: error was expected", value)
+			}
+			continue
+		}
+		if err != nil || rate.Cmp(decimal(t, expected)) != 0 {
+			t.Errorf("%q: expected %v, but got %v, %v", value, expected, rate, err)
+		}
+	}
+}
+
+func TestProcessInvoicesSkipsWrongTaxes(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/1,20220531120000,,50.00,4.00,tax-8,"+walkInId+",P2,Product 2",
+		"FV/2,20220531130000,,100.00,8.00,tax-23,"+walkInId+",P3,Product 3",
+	)
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{TaxTolerance: DefaultTaxTolerance}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][0] != "FV/2" || skipped[0][9] != string(StageTaxCheck) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	invoices := server.Invoices()
+	if len(invoices) != 1 || len(invoices[0].TaxAmounts) != 2 {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
@@ -0,0 +1,227 @@
+package process
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mrsydar/tkl/k360/invoice"
+	"mrsydar/tkl/taxpayer"
+)
+
+// checkAmount returns the problem of an amount written in the report, if
+// any.
+func checkAmount(value string) string {
+	amount, err := invoice.ParseAmount(value)
+	if err != nil {
+		return err.Error()
+	}
+	if !amount.HasPlaces(invoice.AmountPlaces) {
+		return fmt.Sprintf("%q has more than %v decimal places", value, invoice.AmountPlaces)
+	}
+	return ""
+}
+
+func checkQuantity(value string) string {
+	quantity, err := invoice.ParseAmount(value)
+	if err != nil || quantity.Sign() <= 0 || !quantity.HasPlaces(invoice.UnitPricePlaces) {
+		return fmt.Sprintf("%q is not a positive quantity like 2 or 1.5", value)
+	}
+	return ""
+}
+
+// checkUnitPrice returns the problem of a net value which can't be split into
+// the quantity of units, if any. Invalid values are left to the other
+// checks.
+func checkUnitPrice(net, quantity string) string {
+	netValue, err := invoice.ParseAmount(net)
+	if err != nil {
+		return ""
+	}
+	quantityValue, err := invoice.ParseAmount(quantity)
+	if err != nil || quantityValue.Sign() <= 0 {
+		return ""
+	}
+
+	if _, err := invoice.LineFromNet(netValue, invoice.Decimal{}, quantityValue); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+type Problem struct {
+	Line    int
+	Column  string
+	Message string
+}
+
+func (problem Problem) String() string {
+	if problem.Column == "" {
+		return fmt.Sprintf("line %v: %v", problem.Line, problem.Message)
+	}
+	return fmt.Sprintf("line %v: %v: %v", problem.Line, problem.Column, problem.Message)
+}
+
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("report has %v problems, the first one is at %v", len(err.Problems), err.Problems[0])
+}
+
+func ValidateReport(csvPath string, options Options) ([]Problem, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	columns, err := newColumnIndex(header, options)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]Problem, 0)
+	invoices := make(map[string]Record)
+	// finished are the invoices whose records were followed by another
+	// invoice, with GroupConsecutive their number can't come back
+	finished := make(map[string]bool)
+	var previous Record
+	for {
+		rawRecord, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				problems = append(problems, Problem{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read record: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		problems = append(problems, validateRecord(rawRecord, line, len(header), columns, options)...)
+
+		record, err := columns.record(rawRecord, line)
+		if err != nil {
+			continue
+		}
+		record = record.normalized(options)
+
+		key := record.invoiceKey(options.Mode)
+		first, ok := invoices[key]
+		if options.Grouping == GroupConsecutive {
+			previousKey := previous.invoiceKey(options.Mode)
+			if previous.Line != 0 && previousKey != key {
+				finished[previousKey] = true
+			}
+			if finished[key] {
+				problems = append(problems, Problem{line, ColumnNo, fmt.Sprintf("invoice %q is split by other invoices, move its records together or group all records with the same number", record.No)})
+			}
+			ok = previousKey == key
+		}
+		if !ok {
+			invoices[key] = record
+		} else if column, message := invoiceFieldsProblem(first, record); message != "" {
+			problems = append(problems, Problem{line, column, message})
+		}
+		previous = record
+	}
+
+	return problems, nil
+}
+
+func validateRecord(rawRecord []string, line, headerLength int, columns columnIndex, options Options) []Problem {
+	problems := make([]Problem, 0)
+	addProblem := func(column, format string, args ...interface{}) {
+		problems = append(problems, Problem{line, column, fmt.Sprintf(format, args...)})
+	}
+
+	if len(rawRecord) != headerLength {
+		addProblem("", "expected %v fields like in the header, but got %v", headerLength, len(rawRecord))
+	}
+
+	record, err := columns.record(rawRecord, line)
+	if err != nil {
+		return problems
+	}
+	record = record.withDefaults(options)
+
+	if strings.TrimSpace(record.No) == "" {
+		addProblem(ColumnNo, "invoice number is empty")
+	}
+
+	if problem := checkDate(record.Date, options); problem != "" {
+		addProblem(ColumnDate, "%v", problem)
+	}
+
+	if options.Amounts == AmountsGross {
+		if problem := checkAmount(record.Gross); problem != "" {
+			addProblem(ColumnGross, "%v", problem)
+		}
+	} else {
+		if problem := checkAmount(record.Net); problem != "" {
+			addProblem(ColumnNet, "%v", problem)
+		}
+
+		if problem := checkAmount(record.Tax); problem != "" {
+			addProblem(ColumnTax, "%v", problem)
+		}
+	}
+
+	if record.Quantity != "" {
+		if problem := checkQuantity(record.Quantity); problem != "" {
+			addProblem(ColumnQuantity, "%v", problem)
+		} else if options.Amounts == AmountsNet {
+			if problem := checkUnitPrice(record.Net, record.Quantity); problem != "" {
+				addProblem(ColumnQuantity, "%v", problem)
+			}
+		}
+	}
+
+	if record.VatRate != "" {
+		if _, err := parseVatRate(record.VatRate); err != nil {
+			addProblem(ColumnVatRate, "%v", err)
+		}
+	}
+
+	if problem := checkCurrency(record.Currency); problem != "" {
+		addProblem(ColumnCurrency, "%v", problem)
+	}
+
+	checkCreditNote(record, options, addProblem)
+	checkPayment(record, options, addProblem)
+
+	if strings.TrimSpace(record.TaxId) == "" {
+		addProblem(ColumnTaxId, "tax id is empty")
+	}
+
+	if record.CustomerNip != "" {
+		if !taxpayer.IsValidNip(record.CustomerNip) {
+			addProblem(ColumnCustomerNip, "%q is not a valid NIP", record.CustomerNip)
+		}
+	} else if strings.TrimSpace(record.CustomerId) == "" {
+		addProblem(ColumnCustomerId, "customer id is empty and customer nip is not set")
+	}
+
+	if strings.TrimSpace(record.ProductCode) == "" {
+		addProblem(ColumnProductCode, "product code is empty")
+	}
+
+	return problems
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mrsydar/tkl/k360/customer"
+)
+
+func TestValidateReport(t *testing.T) {
+	report := writeReport(t,
+		"FV/1,20220531120000,7792465289,100.00,23.00,tax-23,,P1,Product 1",
+		"FV/2,2022/05/31,7792465288,100,2.3.0,tax-23,,P2,Product 2",
+		",20220531120000,,1,0,,,,Product 3",
+		"FV/4,20220531120000",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	expected := []Problem{
+		{3, ColumnDate, `"2022/05/31" is not a date in any of the formats ` + strings.Join(DefaultDateFormats, ", ") + ` or an Excel serial date`},
+		{3, ColumnTax, `"2.3.0" is not an amount like 1234.50 or 1 234,50`},
+		{3, ColumnCustomerNip, `"7792465288" is not a valid NIP`},
+		{4, ColumnNo, "invoice number is empty"},
+		{4, ColumnTaxId, "tax id is empty"},
+		{4, ColumnCustomerId, "customer id is empty and customer nip is not set"},
+		{4, ColumnProductCode, "product code is empty"},
+		{5, "", "expected 9 fields like in the header, but got 2"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("expected problems %v, but got %v", expected, problems)
+	}
+}
+
+func TestProcessInvoicesRefusesInvalidReport(t *testing.T) {
+	k360, server := setupTest(t)
+
+	report := writeReport(t, "FV/1,31/05/2022,7792465289,100.00,23.00,tax-23,,P1,Product 1")
+
+	_, err := ProcessInvoices(context.Background(), k360, report, Options{}, noProgress)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 {
+		t.Fatalf("expected validation error, but got %v", err)
+	}
+
+	if len(server.Customers()) != 0 || len(server.Invoices()) != 0 {
+		t.Fatalf("nothing should be sent for an invalid report")
+	}
+}
+
+func TestProcessInvoicesSkipsUnparsableRecord(t *testing.T) {
+	k360, server := setupTest(t)
+	walkInId := server.AddCustomer(customer.Customer{Name: "WALK-IN"})
+
+	report := writeReport(t,
+		"FV/1,20220531120000,,100.00,23.00,tax-23,"+walkInId+",P1,Product 1",
+		"FV/2,20220531130000,,50.00,4.00,tax-8,"+walkInId+",P2,Product \"2",
+		"FV/3,20220531140000,,10.00,0.80,tax-8,"+walkInId+",P3,Product 3",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil || len(problems) != 1 || problems[0].Line != 3 {
+		t.Fatalf("unexpected validation result: %v, %v", problems, err)
+	}
+
+	summary, err := ProcessInvoices(context.Background(), k360, report, Options{IgnoreValidationErrors: true}, noProgress)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if summary.Records != 3 || summary.Skipped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if skipped := readSkipped(t); len(skipped) != 1 || skipped[0][0] != "FV/2" || skipped[0][9] != string(StageValidation) {
+		t.Fatalf("unexpected skipped invoices: %v", skipped)
+	}
+
+	if invoices := server.Invoices(); len(invoices) != 2 || invoices[0].No != "FV/1" || invoices[1].No != "FV/3" {
+		t.Fatalf("unexpected invoices: %+v", invoices)
+	}
+}
+
+func TestValidateReportUnitPrice(t *testing.T) {
+	report := writeReportWithHeader(t, testHeader+",quantity",
+		"FV/1,20220531120000,7792465289,10.00,2.30,tax-23,,P1,Product 1,3",
+		"FV/2,20220531120000,7792465289,1.00,0.23,tax-23,,P1,Product 1,300",
+	)
+
+	problems, err := ValidateReport(report, Options{})
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Column != ColumnQuantity {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
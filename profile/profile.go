@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var ErrNotFound = errors.New("profile not found")
+
+// Profile bundles the Księgowość360 account of a company with its upload
+// defaults. The API key is not kept here but in the credentials store under
+// the profile's API ID.
+type Profile struct {
+	Name              string `json:"name"`
+	ApiId             string `json:"apiId"`
+	DefaultTaxId      string `json:"defaultTaxId,omitempty"`
+	DefaultCustomerId string `json:"defaultCustomerId,omitempty"`
+
+	// DefaultPaymentDays is the payment term of invoices without a due date.
+	DefaultPaymentDays int `json:"defaultPaymentDays,omitempty"`
+}
+
+type Profiles []Profile
+
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tkl", "profiles.json"), nil
+}
+
+// Load reads profiles from path, a missing file means no profiles.
+func Load(path string) (Profiles, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Profiles{}, nil
+		}
+		return nil, fmt.Errorf("failed to read profiles: %v", err)
+	}
+
+	var profiles Profiles
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file %v: %v", path, err)
+	}
+
+	return profiles, nil
+}
+
+func (profiles Profiles) Save(path string) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func (profiles Profiles) Get(name string) (Profile, error) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("%w: %q", ErrNotFound, name)
+}
+
+// Set adds the profile or replaces the one with the same name.
+func (profiles Profiles) Set(profile Profile) Profiles {
+	for i := range profiles {
+		if profiles[i].Name == profile.Name {
+			profiles[i] = profile
+			return profiles
+		}
+	}
+
+	profiles = append(profiles, profile)
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+func (profiles Profiles) Delete(name string) Profiles {
+	kept := make(Profiles, 0, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name != name {
+			kept = append(kept, profile)
+		}
+	}
+	return kept
+}
+
+func (profiles Profiles) Names() []string {
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
@@ -0,0 +1,49 @@
+package profile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfilesSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tkl", "profiles.json")
+
+	profiles, err := Load(path)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if len(profiles) != 0 {
+		t.Fatalf("expected no profiles, but got %+v", profiles)
+	}
+
+	profiles = profiles.Set(Profile{Name: "Shop B", ApiId: "id-b"})
+	profiles = profiles.Set(Profile{Name: "Shop A", ApiId: "id-a", DefaultTaxId: "tax-23"})
+	profiles = profiles.Set(Profile{Name: "Shop B", ApiId: "id-b2", DefaultCustomerId: "walk-in"})
+
+	if err := profiles.Save(path); err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+
+	if names := loaded.Names(); len(names) != 2 || names[0] != "Shop A" || names[1] != "Shop B" {
+		t.Fatalf("unexpected profiles: %v", names)
+	}
+
+	shopB, err := loaded.Get("Shop B")
+	if err != nil {
+		t.Fatalf("error was not expected: %v", err)
+	}
+	if shopB != (Profile{Name: "Shop B", ApiId: "id-b2", DefaultCustomerId: "walk-in"}) {
+		t.Fatalf("unexpected profile: %+v", shopB)
+	}
+
+	loaded = loaded.Delete("Shop B")
+	if _, err := loaded.Get("Shop B"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,22 @@
+package taxpayer
+
+var nipWeights = []int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+
+func IsValidNip(nip string) bool {
+	if len(nip) != 10 {
+		return false
+	}
+
+	sum := 0
+	for i, c := range []byte(nip) {
+		if c < '0' || c > '9' {
+			return false
+		}
+		if i < len(nipWeights) {
+			sum += int(c-'0') * nipWeights[i]
+		}
+	}
+
+	checksum := sum % 11
+	return checksum != 10 && checksum == int(nip[9]-'0')
+}
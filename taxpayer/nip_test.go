@@ -0,0 +1,19 @@
+package taxpayer
+
+import "testing"
+
+func TestValidNip(t *testing.T) {
+	for _, nip := range []string{"7792465289", "5260250995"} {
+		if !IsValidNip(nip) {
+			t.Fatalf("expected nip %q to be valid", nip)
+		}
+	}
+}
+
+func TestInvalidNip(t *testing.T) {
+	for _, nip := range []string{"", "7792465288", "779246528", "77924652899", "779-246-52-89", "0000000000a"} {
+		if IsValidNip(nip) {
+			t.Fatalf("expected nip %q to be invalid", nip)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package taxpayer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +12,8 @@ import (
 	"time"
 )
 
+var WhiteListURL = "https://wl-api.mf.gov.pl"
+
 type Address struct {
 	Street      string
 	PostalCode  string
@@ -39,10 +42,10 @@ func NewBufferedTaxpayerDataLoader() *BufferedTaxpayerDataLoader {
 	}
 }
 
-func (loader *BufferedTaxpayerDataLoader) LoadTaxpayerData(nip string) error {
+func (loader *BufferedTaxpayerDataLoader) LoadTaxpayerData(ctx context.Context, nip string) error {
 	loader.nipBuffer = append(loader.nipBuffer, nip)
 	if len(loader.nipBuffer) == cap(loader.nipBuffer) {
-		err := loader.Flush()
+		err := loader.Flush(ctx)
 		if err != nil {
 			return fmt.Errorf("flush error: %v", err)
 		}
@@ -50,7 +53,7 @@ func (loader *BufferedTaxpayerDataLoader) LoadTaxpayerData(nip string) error {
 	return nil
 }
 
-func (loader *BufferedTaxpayerDataLoader) Flush() error {
+func (loader *BufferedTaxpayerDataLoader) Flush(ctx context.Context) error {
 	loc, _ := time.LoadLocation("Europe/Warsaw")
 	plTime := time.Now().In(loc)
 
@@ -58,13 +61,21 @@ func (loader *BufferedTaxpayerDataLoader) Flush() error {
 		return nil
 	}
 
-	url := fmt.Sprintf("https://wl-api.mf.gov.pl/api/search/nips/%s?date=%d-%02d-%02d", strings.Join(loader.nipBuffer, ","), plTime.Year(), plTime.Month(), plTime.Day())
+	url := fmt.Sprintf("%s/api/search/nips/%s?date=%d-%02d-%02d", WhiteListURL, strings.Join(loader.nipBuffer, ","), plTime.Year(), plTime.Month(), plTime.Day())
 	loader.nipBuffer = loader.nipBuffer[:0]
 
-	response, err := http.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return err
-	} else if response.StatusCode < 200 || response.StatusCode >= 300 {
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
 		if responseBodyByteArray, err := ioutil.ReadAll(response.Body); err != nil {
 			return fmt.Errorf("bad response with code %v", response.StatusCode)
 		} else {
@@ -187,7 +198,7 @@ func GetTaxpayerData(nip string) (*Taxpayer, error) {
 	loc, _ := time.LoadLocation("Europe/Warsaw")
 	plTime := time.Now().In(loc)
 
-	url := fmt.Sprintf("https://wl-api.mf.gov.pl/api/search/nip/%s?date=%d-%02d-%02d", nip, plTime.Year(), plTime.Month(), plTime.Day())
+	url := fmt.Sprintf("%s/api/search/nip/%s?date=%d-%02d-%02d", WhiteListURL, nip, plTime.Year(), plTime.Month(), plTime.Day())
 
 	response, err := http.Get(url)
 	if err != nil {
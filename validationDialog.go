@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"mrsydar/tkl/process"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func showValidationProblems(problems []process.Problem, window fyne.Window, onOverride, onCancel func()) {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = problem.String()
+	}
+
+	problemsLabel := widget.NewLabel(strings.Join(lines, "\n"))
+	problemsScroll := container.NewVScroll(problemsLabel)
+	problemsScroll.SetMinSize(fyne.NewSize(600, 300))
+
+	content := container.NewBorder(
+		widget.NewLabel(fmt.Sprintf(textValidationProblems, len(problems))),
+		nil, nil, nil,
+		problemsScroll,
+	)
+
+	dialog.ShowCustomConfirm(textValidationTitle, textUploadValid, textCancel, content, func(override bool) {
+		if override {
+			onOverride()
+		} else {
+			onCancel()
+		}
+	}, window)
+}